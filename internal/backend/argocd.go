@@ -0,0 +1,297 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ArgoCD reads applications from the REST API of an Argo CD server, authenticating with an Argo CD API token,
+// so that deployvia does not need access to the Kubernetes API of the management cluster.
+type ArgoCD struct {
+	server     string
+	token      string
+	namespaces []string
+	httpClient *http.Client
+}
+
+// NewArgoCD returns a backend for the Argo CD server at the URL, reading applications in the namespaces;
+// a single empty namespace means all namespaces. The HTTP client must not time out, since watches are long-lived streams.
+func NewArgoCD(server string, token string, namespaces []string, httpClient *http.Client) *ArgoCD {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &ArgoCD{
+		server:     strings.TrimSuffix(server, "/"),
+		token:      token,
+		namespaces: namespaces,
+		httpClient: httpClient,
+	}
+}
+
+// List returns the applications matching the label selector in the namespaces of the backend.
+func (a *ArgoCD) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	query := url.Values{}
+	if opts.LabelSelector != "" {
+		query.Set("selector", opts.LabelSelector)
+	}
+
+	if len(a.namespaces) == 1 && a.namespaces[0] != metav1.NamespaceAll {
+		query.Set("appNamespace", a.namespaces[0])
+	}
+
+	var applicationList struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []map[string]any `json:"items"`
+	}
+
+	resp, err := a.get(ctx, "/api/v1/applications", query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&applicationList); err != nil {
+		return nil, fmt.Errorf("failed to decode applications: %w", err)
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetResourceVersion(applicationList.Metadata.ResourceVersion)
+
+	for _, item := range applicationList.Items {
+		application := unstructured.Unstructured{Object: item}
+		if !a.readsNamespace(application.GetNamespace()) {
+			continue
+		}
+
+		// The API omits the type of the items.
+		application.SetAPIVersion("argoproj.io/v1alpha1")
+		application.SetKind("Application")
+
+		list.Items = append(list.Items, application)
+	}
+
+	return list, nil
+}
+
+// Watch streams changes to the application selected by the 'metadata.namespace' and 'metadata.name' field selector.
+func (a *ArgoCD) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector: %w", err)
+	}
+
+	query := url.Values{}
+	if name, found := fieldSelector.RequiresExactMatch("metadata.name"); found {
+		query.Set("name", name)
+	}
+
+	if namespace, found := fieldSelector.RequiresExactMatch("metadata.namespace"); found && namespace != metav1.NamespaceAll {
+		query.Set("appNamespace", namespace)
+	}
+
+	if opts.ResourceVersion != "" {
+		query.Set("resourceVersion", opts.ResourceVersion)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	resp, err := a.get(ctx, "/api/v1/stream/applications", query)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	w := &streamWatcher{
+		result: make(chan watch.Event),
+		cancel: cancel,
+	}
+
+	go w.run(ctx, resp.Body)
+
+	return w, nil
+}
+
+// GetResourceTree returns every node of the resource tree of the application, without sync statuses.
+func (a *ArgoCD) GetResourceTree(ctx context.Context, namespace string, name string) ([]model.ResourceStatus, error) {
+	query := url.Values{}
+	if namespace != metav1.NamespaceAll {
+		query.Set("appNamespace", namespace)
+	}
+
+	resp, err := a.get(ctx, "/api/v1/applications/"+url.PathEscape(name)+"/resource-tree", query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	var tree struct {
+		Nodes []struct {
+			Group     string `json:"group"`
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+			Health    struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"health"`
+		} `json:"nodes"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to decode resource tree: %w", err)
+	}
+
+	resources := make([]model.ResourceStatus, 0, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		resources = append(resources, model.ResourceStatus{
+			Group:         node.Group,
+			Kind:          node.Kind,
+			Namespace:     node.Namespace,
+			Name:          node.Name,
+			HealthStatus:  node.Health.Status,
+			HealthMessage: node.Health.Message,
+		})
+	}
+
+	return resources, nil
+}
+
+func (a *ArgoCD) readsNamespace(namespace string) bool {
+	return len(a.namespaces) == 0 ||
+		slices.Contains(a.namespaces, metav1.NamespaceAll) ||
+		slices.Contains(a.namespaces, namespace)
+}
+
+// Sends a GET request to the API, returning an error for any response but 200 OK.
+func (a *ArgoCD) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	endpoint := a.server + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Argo CD API: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		return nil, newAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+// apiError is the error body of the Argo CD API.
+type apiError struct {
+	Message string `json:"message"`
+	// Only set in errors within streams.
+	HTTPCode int `json:"http_code"`
+}
+
+func newAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	var apiErr apiError
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Message == "" {
+		return fmt.Errorf("argo cd api returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return fmt.Errorf("argo cd api returned %s: %s", resp.Status, apiErr.Message)
+}
+
+// streamWatcher turns the newline-delimited JSON of an Argo CD application stream into watch events.
+type streamWatcher struct {
+	result chan watch.Event
+	cancel context.CancelFunc
+}
+
+func (w *streamWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *streamWatcher) Stop() {
+	w.cancel()
+}
+
+func (w *streamWatcher) run(ctx context.Context, body io.ReadCloser) {
+	defer close(w.result)
+	defer body.Close()
+
+	decoder := json.NewDecoder(body)
+
+	for {
+		var chunk struct {
+			Result *struct {
+				Type        watch.EventType `json:"type"`
+				Application map[string]any  `json:"application"`
+			} `json:"result"`
+			Error *apiError `json:"error"`
+		}
+
+		if err := decoder.Decode(&chunk); err != nil {
+			if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+				log.Warnf("Failed to read Argo CD application stream: %v", err)
+			}
+
+			return
+		}
+
+		var evt watch.Event
+
+		switch {
+		case chunk.Error != nil:
+			evt = watch.Event{
+				Type: watch.Error,
+				Object: &metav1.Status{
+					Status:  metav1.StatusFailure,
+					Code:    int32(chunk.Error.HTTPCode),
+					Message: chunk.Error.Message,
+				},
+			}
+		case chunk.Result != nil:
+			application := &unstructured.Unstructured{Object: chunk.Result.Application}
+			application.SetAPIVersion("argoproj.io/v1alpha1")
+			application.SetKind("Application")
+
+			evt = watch.Event{Type: chunk.Result.Type, Object: application}
+		default:
+			continue
+		}
+
+		select {
+		case w.result <- evt:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
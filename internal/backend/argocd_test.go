@@ -0,0 +1,222 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const testToken = "argocd-token"
+
+func newArgoCDStub(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/v1/applications", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("selector") != "elvia.no/system=core" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"unexpected selector","code":3,"message":"unexpected selector"}`)
+
+			return
+		}
+
+		fmt.Fprint(w, `{"metadata":{"resourceVersion":"42"},"items":[
+			{"metadata":{"name":"core-demo-api-dev-aks","namespace":"argocd"}},
+			{"metadata":{"name":"core-demo-api-dev-gke","namespace":"team-core"}},
+			{"metadata":{"name":"other-demo-api-dev-aks","namespace":"team-other"}}
+		]}`)
+	})
+
+	mux.HandleFunc("GET /api/v1/stream/applications", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "core-demo-api-dev-aks" || r.URL.Query().Get("appNamespace") != "argocd" {
+			fmt.Fprint(w, `{"error":{"grpc_code":5,"http_code":404,"message":"application not found","http_status":"Not Found"}}`+"\n")
+
+			return
+		}
+
+		fmt.Fprint(w, `{"result":{"type":"ADDED","application":{"metadata":{"name":"core-demo-api-dev-aks","namespace":"argocd","resourceVersion":"1"},"status":{"health":{"status":"Progressing"}}}}}`+"\n")
+		w.(http.Flusher).Flush()
+		fmt.Fprint(w, `{"result":{"type":"MODIFIED","application":{"metadata":{"name":"core-demo-api-dev-aks","namespace":"argocd","resourceVersion":"2"},"status":{"health":{"status":"Healthy"}}}}}`+"\n")
+	})
+
+	mux.HandleFunc("GET /api/v1/applications/core-demo-api-dev-aks/resource-tree", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"nodes":[
+			{"group":"apps","kind":"Deployment","namespace":"core","name":"demo-api","health":{"status":"Degraded","message":"progress deadline exceeded"}},
+			{"kind":"Pod","namespace":"core","name":"demo-api-7d9f8","health":{"status":"Degraded","message":"back-off restarting failed container"}}
+		]}`)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid session","code":16,"message":"invalid session: token is not valid"}`)
+
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestArgoCDList(t *testing.T) {
+	server := newArgoCDStub(t)
+
+	tests := []struct {
+		name          string
+		namespaces    []string
+		expectedNames []string
+	}{
+		{
+			name:          "all namespaces",
+			namespaces:    []string{metav1.NamespaceAll},
+			expectedNames: []string{"core-demo-api-dev-aks", "core-demo-api-dev-gke", "other-demo-api-dev-aks"},
+		},
+		{
+			name:          "watched namespaces",
+			namespaces:    []string{"argocd", "team-core"},
+			expectedNames: []string{"core-demo-api-dev-aks", "core-demo-api-dev-gke"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argoCD := NewArgoCD(server.URL+"/", testToken, tt.namespaces, server.Client())
+
+			applications, err := argoCD.List(context.Background(), metav1.ListOptions{LabelSelector: "elvia.no/system=core"})
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+
+			if applications.GetResourceVersion() != "42" {
+				t.Errorf("List() resourceVersion = %s, expected 42", applications.GetResourceVersion())
+			}
+
+			var names []string
+			for _, application := range applications.Items {
+				names = append(names, application.GetName())
+
+				if application.GetKind() != "Application" {
+					t.Errorf("List() kind of %s = %s, expected Application", application.GetName(), application.GetKind())
+				}
+			}
+
+			if fmt.Sprint(names) != fmt.Sprint(tt.expectedNames) {
+				t.Errorf("List() = %v, expected %v", names, tt.expectedNames)
+			}
+		})
+	}
+}
+
+func TestArgoCDListInvalidToken(t *testing.T) {
+	server := newArgoCDStub(t)
+	argoCD := NewArgoCD(server.URL, "expired-token", []string{"argocd"}, server.Client())
+
+	_, err := argoCD.List(context.Background(), metav1.ListOptions{LabelSelector: "elvia.no/system=core"})
+
+	expected := "argo cd api returned 401 Unauthorized: invalid session: token is not valid"
+	if err == nil || err.Error() != expected {
+		t.Errorf("List() error = '%v', expected '%s'", err, expected)
+	}
+}
+
+func TestArgoCDWatch(t *testing.T) {
+	server := newArgoCDStub(t)
+	argoCD := NewArgoCD(server.URL, testToken, []string{"argocd"}, server.Client())
+
+	w, err := argoCD.Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: "metadata.namespace=argocd,metadata.name=core-demo-api-dev-aks",
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	defer w.Stop()
+
+	for _, expected := range []struct {
+		eventType    watch.EventType
+		healthStatus string
+	}{
+		{watch.Added, "Progressing"},
+		{watch.Modified, "Healthy"},
+	} {
+		select {
+		case evt := <-w.ResultChan():
+			obj, ok := evt.Object.(*unstructured.Unstructured)
+			if !ok {
+				t.Fatalf("Watch() returned %T, expected *unstructured.Unstructured", evt.Object)
+			}
+
+			healthStatus, _, _ := unstructured.NestedString(obj.Object, "status", "health", "status")
+			if evt.Type != expected.eventType || healthStatus != expected.healthStatus {
+				t.Errorf("Watch() event = %s %s, expected %s %s", evt.Type, healthStatus, expected.eventType, expected.healthStatus)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Watch() did not return a %s event", expected.eventType)
+		}
+	}
+
+	select {
+	case _, ok := <-w.ResultChan():
+		if ok {
+			t.Error("Watch() returned an unexpected event")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Watch() was not closed at the end of the stream")
+	}
+}
+
+func TestArgoCDWatchError(t *testing.T) {
+	server := newArgoCDStub(t)
+	argoCD := NewArgoCD(server.URL, testToken, []string{"argocd"}, server.Client())
+
+	w, err := argoCD.Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: "metadata.namespace=argocd,metadata.name=core-demo-api-dev-gke",
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	defer w.Stop()
+
+	select {
+	case evt := <-w.ResultChan():
+		if evt.Type != watch.Error {
+			t.Fatalf("Watch() event type = %s, expected %s", evt.Type, watch.Error)
+		}
+
+		if err := apierrors.FromObject(evt.Object); !apierrors.IsNotFound(err) {
+			t.Errorf("Watch() error = '%v', expected not found", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not return an error event")
+	}
+}
+
+func TestArgoCDGetResourceTree(t *testing.T) {
+	server := newArgoCDStub(t)
+	argoCD := NewArgoCD(server.URL, testToken, []string{"argocd"}, server.Client())
+
+	resources, err := argoCD.GetResourceTree(context.Background(), "argocd", "core-demo-api-dev-aks")
+	if err != nil {
+		t.Fatalf("GetResourceTree() error = %v", err)
+	}
+
+	if len(resources) != 2 {
+		t.Fatalf("GetResourceTree() returned %d resources, expected 2", len(resources))
+	}
+
+	expected := "Pod/core/demo-api-7d9f8 (Degraded): back-off restarting failed container"
+	if resources[1].String() != expected {
+		t.Errorf("GetResourceTree() returned %s, expected %s", resources[1], expected)
+	}
+}
@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"context"
+
+	"github.com/3lvia/deployvia/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// StatusBackend reports the status of Argo CD applications, in the layout of the Application CRD.
+type StatusBackend interface {
+	// List returns the applications matching the label selector.
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+	// Watch streams changes to the application selected by the 'metadata.namespace' and 'metadata.name' field selector.
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+	// GetResourceTree returns the resources of an application, including those created by its managed resources if known, e.g. pods.
+	GetResourceTree(ctx context.Context, namespace string, name string) ([]model.ResourceStatus, error)
+}
+
+// ApplicationLister lists and watches Argo CD applications in a namespace.
+// It is implemented by both 'dynamic.ResourceInterface' and the shared 'informer.ApplicationInformer'.
+type ApplicationLister interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// Kubernetes reads applications from the Application CRD in a namespace of the management cluster.
+type Kubernetes struct {
+	ApplicationLister
+}
+
+// NewKubernetes lists and watches applications with the lister, e.g. an informer.
+func NewKubernetes(applicationLister ApplicationLister) *Kubernetes {
+	return &Kubernetes{
+		ApplicationLister: applicationLister,
+	}
+}
+
+// GetResourceTree returns no resources, since the full tree is only kept by Argo CD itself,
+// and the resources in 'status.resources' are already read from the application.
+func (k *Kubernetes) GetResourceTree(context.Context, string, string) ([]model.ResourceStatus, error) {
+	return nil, nil
+}
+
+// GetApplicationResources returns the resources in 'status.resources' of an application.
+func GetApplicationResources(application *unstructured.Unstructured) []model.ResourceStatus {
+	resources, _, _ := unstructured.NestedSlice(application.Object, "status", "resources")
+
+	resourceStatuses := make([]model.ResourceStatus, 0, len(resources))
+	for _, resource := range resources {
+		resourceMap, ok := resource.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		resourceStatus := model.ResourceStatus{}
+		resourceStatus.Group, _, _ = unstructured.NestedString(resourceMap, "group")
+		resourceStatus.Kind, _, _ = unstructured.NestedString(resourceMap, "kind")
+		resourceStatus.Namespace, _, _ = unstructured.NestedString(resourceMap, "namespace")
+		resourceStatus.Name, _, _ = unstructured.NestedString(resourceMap, "name")
+		resourceStatus.SyncStatus, _, _ = unstructured.NestedString(resourceMap, "status")
+		resourceStatus.HealthStatus, _, _ = unstructured.NestedString(resourceMap, "health", "status")
+		resourceStatus.HealthMessage, _, _ = unstructured.NestedString(resourceMap, "health", "message")
+
+		resourceStatuses = append(resourceStatuses, resourceStatus)
+	}
+
+	return resourceStatuses
+}
@@ -0,0 +1,488 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	KustomizationGVR = schema.GroupVersionResource{
+		Group:    "kustomize.toolkit.fluxcd.io",
+		Version:  "v1",
+		Resource: "kustomizations",
+	}
+	HelmReleaseGVR = schema.GroupVersionResource{
+		Group:    "helm.toolkit.fluxcd.io",
+		Version:  "v2",
+		Resource: "helmreleases",
+	}
+	DeploymentGVR = schema.GroupVersionResource{
+		Group:    "apps",
+		Version:  "v1",
+		Resource: "deployments",
+	}
+)
+
+// How often the last Kustomization or HelmRelease of a watch is converted again, to notice rollouts of its Deployments.
+var fluxResyncInterval = 10 * time.Second
+
+// Reasons of a 'Ready=False' condition that mean Flux is waiting, not that the reconciliation failed.
+var fluxWaitingReasons = []string{"DependencyNotReady", "Progressing"}
+
+// Flux reads the Kustomizations and HelmReleases in a namespace, and presents them in the layout of the Application CRD,
+// so that they are checked like Argo CD applications. The images are those of the Deployments they reconcile.
+type Flux struct {
+	client    dynamic.Interface
+	namespace string
+}
+
+// NewFlux returns a backend for the Kustomizations and HelmReleases in the namespace.
+func NewFlux(client dynamic.Interface, namespace string) *Flux {
+	return &Flux{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// List returns the Kustomizations and HelmReleases matching the label selector.
+func (f *Flux) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list := &unstructured.UnstructuredList{}
+
+	for _, gvr := range []schema.GroupVersionResource{KustomizationGVR, HelmReleaseGVR} {
+		objs, err := f.client.Resource(gvr).Namespace(f.namespace).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", gvr.Resource, err)
+		}
+
+		for _, obj := range objs.Items {
+			application, err := f.toApplication(ctx, &obj)
+			if err != nil {
+				return nil, err
+			}
+
+			list.Items = append(list.Items, *application)
+		}
+	}
+
+	return list, nil
+}
+
+// Watch streams changes to the Kustomization or HelmRelease selected by the 'metadata.name' field selector.
+func (f *Flux) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector: %w", err)
+	}
+
+	name, found := fieldSelector.RequiresExactMatch("metadata.name")
+	if !found {
+		return nil, fmt.Errorf("watching Flux resources requires a metadata.name field selector")
+	}
+
+	namespace, found := fieldSelector.RequiresExactMatch("metadata.namespace")
+	if !found {
+		namespace = f.namespace
+	}
+
+	gvr, err := f.getResource(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := f.client.Resource(gvr).Namespace(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:       fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion:     opts.ResourceVersion,
+		AllowWatchBookmarks: opts.AllowWatchBookmarks,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	fw := &fluxWatcher{
+		flux:   f,
+		result: make(chan watch.Event),
+		cancel: cancel,
+	}
+
+	go fw.run(ctx, w)
+
+	return fw, nil
+}
+
+// GetResourceTree returns the Deployments reconciled by the Kustomization or HelmRelease, with their health.
+func (f *Flux) GetResourceTree(ctx context.Context, namespace string, name string) ([]model.ResourceStatus, error) {
+	gvr, err := f.getResource(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := f.client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := f.getDeployments(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]model.ResourceStatus, 0, len(deployments))
+	for _, deployment := range deployments {
+		resources = append(resources, getDeploymentStatus(&deployment))
+	}
+
+	return resources, nil
+}
+
+// Returns whether the name is a Kustomization or a HelmRelease, preferring Kustomizations.
+func (f *Flux) getResource(ctx context.Context, namespace string, name string) (schema.GroupVersionResource, error) {
+	for _, gvr := range []schema.GroupVersionResource{KustomizationGVR, HelmReleaseGVR} {
+		_, err := f.client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			return gvr, nil
+		}
+
+		if !apierrors.IsNotFound(err) {
+			return schema.GroupVersionResource{}, fmt.Errorf("failed to get %s %s: %w", gvr.Resource, name, err)
+		}
+	}
+
+	return schema.GroupVersionResource{}, fmt.Errorf("no Kustomization or HelmRelease %s in namespace %s", name, namespace)
+}
+
+// Converts a Kustomization or HelmRelease to the layout of an Argo CD application:
+//   - it is synced once the latest generation and revision has been applied,
+//   - healthy if it is ready, degraded if its health checks failed, and progressing otherwise,
+//   - and its sync failed if it is not ready for any other reason.
+func (f *Flux) toApplication(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	deployments, err := f.getDeployments(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, _, _ := unstructured.NestedMap(obj.Object, "metadata")
+	observedGeneration, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	lastAppliedRevision, _, _ := unstructured.NestedString(obj.Object, "status", "lastAppliedRevision")
+	lastAttemptedRevision, _, _ := unstructured.NestedString(obj.Object, "status", "lastAttemptedRevision")
+
+	// HelmReleases no longer report the applied revision, but the chart version of their latest release.
+	if lastAppliedRevision == "" {
+		if history, _, _ := unstructured.NestedSlice(obj.Object, "status", "history"); len(history) > 0 {
+			if snapshot, ok := history[0].(map[string]any); ok {
+				lastAppliedRevision, _, _ = unstructured.NestedString(snapshot, "chartVersion")
+			}
+		}
+	}
+
+	ready := getCondition(obj, "Ready")
+	// A Ready condition of a previous generation still describes the previous revision, so the new one is progressing until it is updated.
+	if isConditionStale(obj, "Ready") {
+		ready = map[string]string{}
+	}
+
+	reconciled := observedGeneration >= obj.GetGeneration() &&
+		(lastAttemptedRevision == "" || lastAttemptedRevision == lastAppliedRevision)
+
+	syncStatus := "OutOfSync"
+	if ready["status"] == "True" && reconciled {
+		syncStatus = "Synced"
+	}
+
+	healthStatus := "Progressing"
+	switch {
+	case ready["status"] == "True":
+		healthStatus = "Healthy"
+	case ready["status"] == "False" && ready["reason"] == "HealthCheckFailed":
+		healthStatus = "Degraded"
+	}
+
+	healthMessage := ready["message"]
+	images := []any{}
+	resources := []any{}
+
+	for _, deployment := range deployments {
+		for _, image := range getDeploymentImages(&deployment) {
+			if !slices.Contains(images, any(image)) {
+				images = append(images, image)
+			}
+		}
+
+		// Without health checks, Flux is ready as soon as the Deployments are applied, before they are rolled out.
+		resource := getDeploymentStatus(&deployment)
+		if (healthStatus == "Healthy" && resource.HealthStatus != "Healthy") || resource.HealthStatus == "Degraded" {
+			healthStatus = resource.HealthStatus
+			healthMessage = resource.HealthMessage
+		}
+
+		resources = append(resources, map[string]any{
+			"group":     resource.Group,
+			"kind":      resource.Kind,
+			"namespace": resource.Namespace,
+			"name":      resource.Name,
+			"status":    resource.SyncStatus,
+			"health":    map[string]any{"status": resource.HealthStatus, "message": resource.HealthMessage},
+		})
+	}
+
+	status := map[string]any{
+		"sync":      map[string]any{"status": syncStatus, "revision": lastAppliedRevision},
+		"health":    map[string]any{"status": healthStatus, "message": healthMessage},
+		"summary":   map[string]any{"images": images},
+		"resources": resources,
+	}
+
+	switch {
+	case ready["status"] == "True":
+		status["operationState"] = map[string]any{
+			"phase":      "Succeeded",
+			"finishedAt": ready["lastTransitionTime"],
+		}
+	case ready["status"] == "False" && ready["reason"] != "HealthCheckFailed" && !slices.Contains(fluxWaitingReasons, ready["reason"]):
+		status["operationState"] = map[string]any{
+			"phase":   "Failed",
+			"message": fmt.Sprintf("%s: %s", ready["reason"], ready["message"]),
+		}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": obj.GetAPIVersion(),
+		"kind":       obj.GetKind(),
+		"metadata":   metadata,
+		"status":     status,
+	}}, nil
+}
+
+// fluxWatcher converts the events of a Kustomization or HelmRelease watch to applications.
+// Since the rollout of the Deployments does not always change the Flux resource, the last one is also converted again periodically,
+// and sent if its application has changed.
+type fluxWatcher struct {
+	flux   *Flux
+	result chan watch.Event
+	cancel context.CancelFunc
+}
+
+func (fw *fluxWatcher) ResultChan() <-chan watch.Event {
+	return fw.result
+}
+
+func (fw *fluxWatcher) Stop() {
+	fw.cancel()
+}
+
+func (fw *fluxWatcher) run(ctx context.Context, w watch.Interface) {
+	defer close(fw.result)
+	defer w.Stop()
+
+	ticker := time.NewTicker(fluxResyncInterval)
+	defer ticker.Stop()
+
+	var last, lastApplication *unstructured.Unstructured
+
+	for {
+		var (
+			evt    watch.Event
+			resync bool
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if last == nil {
+				continue
+			}
+
+			evt = watch.Event{Type: watch.Modified, Object: last}
+			resync = true
+		case received, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+
+			evt = received
+		}
+
+		if obj, ok := evt.Object.(*unstructured.Unstructured); ok && evt.Type != watch.Bookmark && evt.Type != watch.Error {
+			last = obj
+
+			application, err := fw.flux.toApplication(ctx, obj)
+			switch {
+			case err != nil:
+				evt = watch.Event{Type: watch.Error, Object: &apierrors.NewInternalError(err).ErrStatus}
+			case resync && equality.Semantic.DeepEqual(application, lastApplication):
+				continue
+			default:
+				evt.Object = application
+				lastApplication = application
+			}
+		}
+
+		select {
+		case fw.result <- evt:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Returns the Deployments reconciled by the Kustomization, from its inventory, or by the HelmRelease, from the labels set by Flux.
+func (f *Flux) getDeployments(ctx context.Context, obj *unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	if obj.GetKind() == "HelmRelease" {
+		targetNamespace, _, _ := unstructured.NestedString(obj.Object, "spec", "targetNamespace")
+		if targetNamespace == "" {
+			targetNamespace = obj.GetNamespace()
+		}
+
+		deployments, err := f.client.Resource(DeploymentGVR).Namespace(targetNamespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf(
+				"helm.toolkit.fluxcd.io/name=%s,helm.toolkit.fluxcd.io/namespace=%s",
+				obj.GetName(),
+				obj.GetNamespace(),
+			),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list deployments of HelmRelease %s: %w", obj.GetName(), err)
+		}
+
+		return deployments.Items, nil
+	}
+
+	entries, _, _ := unstructured.NestedSlice(obj.Object, "status", "inventory", "entries")
+
+	var deployments []unstructured.Unstructured
+	for _, entry := range entries {
+		entryMap, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		// Inventory IDs are '<namespace>_<name>_<group>_<kind>'.
+		id, _, _ := unstructured.NestedString(entryMap, "id")
+		parts := strings.Split(id, "_")
+		if len(parts) != 4 || parts[2] != DeploymentGVR.Group || parts[3] != "Deployment" {
+			continue
+		}
+
+		deployment, err := f.client.Resource(DeploymentGVR).Namespace(parts[0]).Get(ctx, parts[1], metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployment %s of Kustomization %s: %w", parts[1], obj.GetName(), err)
+		}
+
+		deployments = append(deployments, *deployment)
+	}
+
+	return deployments, nil
+}
+
+// Returns whether the condition was observed for an older generation than the current one of the object.
+func isConditionStale(obj *unstructured.Unstructured, conditionType string) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]any)
+		if !ok || conditionMap["type"] != conditionType {
+			continue
+		}
+
+		observedGeneration, found, _ := unstructured.NestedInt64(conditionMap, "observedGeneration")
+
+		return found && observedGeneration < obj.GetGeneration()
+	}
+
+	return false
+}
+
+// Returns the fields of the condition of the type as strings, empty if it is missing.
+func getCondition(obj *unstructured.Unstructured, conditionType string) map[string]string {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]any)
+		if !ok || conditionMap["type"] != conditionType {
+			continue
+		}
+
+		values := make(map[string]string, len(conditionMap))
+		for key, value := range conditionMap {
+			if s, ok := value.(string); ok {
+				values[key] = s
+			}
+		}
+
+		return values
+	}
+
+	return map[string]string{}
+}
+
+func getDeploymentImages(deployment *unstructured.Unstructured) []string {
+	containers, _, _ := unstructured.NestedSlice(deployment.Object, "spec", "template", "spec", "containers")
+
+	images := make([]string, 0, len(containers))
+	for _, container := range containers {
+		if containerMap, ok := container.(map[string]any); ok {
+			if image, ok := containerMap["image"].(string); ok {
+				images = append(images, image)
+			}
+		}
+	}
+
+	return images
+}
+
+// Returns the health of a Deployment like Argo CD: progressing until the latest generation is rolled out and available,
+// and degraded if its progress deadline was exceeded.
+func getDeploymentStatus(deployment *unstructured.Unstructured) model.ResourceStatus {
+	resourceStatus := model.ResourceStatus{
+		Group:      DeploymentGVR.Group,
+		Kind:       "Deployment",
+		Namespace:  deployment.GetNamespace(),
+		Name:       deployment.GetName(),
+		SyncStatus: "Synced",
+	}
+
+	observedGeneration, _, _ := unstructured.NestedInt64(deployment.Object, "status", "observedGeneration")
+	replicas, found, _ := unstructured.NestedInt64(deployment.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+
+	updatedReplicas, _, _ := unstructured.NestedInt64(deployment.Object, "status", "updatedReplicas")
+	availableReplicas, _, _ := unstructured.NestedInt64(deployment.Object, "status", "availableReplicas")
+	progressing := getCondition(deployment, "Progressing")
+
+	switch {
+	case progressing["reason"] == "ProgressDeadlineExceeded":
+		resourceStatus.HealthStatus = "Degraded"
+		resourceStatus.HealthMessage = progressing["message"]
+	case observedGeneration < deployment.GetGeneration():
+		resourceStatus.HealthStatus = "Progressing"
+		resourceStatus.HealthMessage = "waiting for rollout to be observed"
+	case updatedReplicas < replicas:
+		resourceStatus.HealthStatus = "Progressing"
+		resourceStatus.HealthMessage = fmt.Sprintf("%d of %d replicas updated", updatedReplicas, replicas)
+	case availableReplicas < updatedReplicas:
+		resourceStatus.HealthStatus = "Progressing"
+		resourceStatus.HealthMessage = fmt.Sprintf("%d of %d updated replicas available", availableReplicas, updatedReplicas)
+	default:
+		resourceStatus.HealthStatus = "Healthy"
+	}
+
+	return resourceStatus
+}
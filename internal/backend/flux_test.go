@@ -0,0 +1,295 @@
+package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const fluxImage = "ghcr.io/3lvia/core-demo-api:dev@sha256:1234567890abcdef"
+
+var fluxLabels = map[string]any{
+	"elvia.no/system":           "core",
+	"elvia.no/application":      "demo-api",
+	"kubernetes.io/environment": "dev",
+	"elvia.no/cluster-type":     "aks",
+}
+
+func newFluxClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			KustomizationGVR: "KustomizationList",
+			HelmReleaseGVR:   "HelmReleaseList",
+			DeploymentGVR:    "DeploymentList",
+		},
+		objects...,
+	)
+}
+
+func newKustomization(name string, ready map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+		"kind":       "Kustomization",
+		"metadata": map[string]any{
+			"name":       name,
+			"namespace":  "flux-system",
+			"generation": int64(2),
+			"labels":     fluxLabels,
+		},
+		"status": map[string]any{
+			"observedGeneration":    int64(2),
+			"lastAppliedRevision":   "main@sha1:abc",
+			"lastAttemptedRevision": "main@sha1:abc",
+			"conditions":            []any{ready},
+			"inventory": map[string]any{
+				"entries": []any{
+					map[string]any{"id": "core_demo-api_apps_Deployment", "v": "v1"},
+					map[string]any{"id": "core_demo-api__Service", "v": "v1"},
+				},
+			},
+		},
+	}}
+}
+
+func newDeployment(namespace string, name string, labels map[string]any, updatedReplicas int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":       name,
+			"namespace":  namespace,
+			"generation": int64(1),
+			"labels":     labels,
+		},
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "demo-api", "image": fluxImage}},
+				},
+			},
+		},
+		"status": map[string]any{
+			"observedGeneration": int64(1),
+			"updatedReplicas":    updatedReplicas,
+			"availableReplicas":  updatedReplicas,
+		},
+	}}
+}
+
+func TestFluxList(t *testing.T) {
+	helmRelease := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "helm.toolkit.fluxcd.io/v2",
+		"kind":       "HelmRelease",
+		"metadata": map[string]any{
+			"name":      "demo-api-chart",
+			"namespace": "flux-system",
+			"labels":    fluxLabels,
+		},
+		"spec": map[string]any{"targetNamespace": "core"},
+		"status": map[string]any{
+			"lastAttemptedRevision": "1.2.0",
+			"history":               []any{map[string]any{"chartVersion": "1.1.0"}},
+			"conditions": []any{map[string]any{
+				"type":    "Ready",
+				"status":  "False",
+				"reason":  "UpgradeFailed",
+				"message": "Helm upgrade failed: timed out waiting for the condition",
+			}},
+		},
+	}}
+
+	client := newFluxClient(
+		newKustomization("core-demo-api-dev-aks", map[string]any{
+			"type":               "Ready",
+			"status":             "True",
+			"reason":             "ReconciliationSucceeded",
+			"lastTransitionTime": "2025-01-02T03:04:05Z",
+		}),
+		helmRelease,
+		newDeployment("core", "demo-api", nil, 2),
+		newDeployment("core", "demo-api-worker", map[string]any{
+			"helm.toolkit.fluxcd.io/name":      "demo-api-chart",
+			"helm.toolkit.fluxcd.io/namespace": "flux-system",
+		}, 1),
+	)
+
+	applications, err := NewFlux(client, "flux-system").List(context.Background(), metav1.ListOptions{
+		LabelSelector: "elvia.no/system=core,elvia.no/application=demo-api",
+	})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if len(applications.Items) != 2 {
+		t.Fatalf("List() returned %d applications, expected 2", len(applications.Items))
+	}
+
+	tests := []struct {
+		name                  string
+		expectedSync          string
+		expectedHealth        string
+		expectedRevision      string
+		expectedPhase         string
+		expectedResourceState string
+	}{
+		{
+			name:                  "core-demo-api-dev-aks",
+			expectedSync:          "Synced",
+			expectedHealth:        "Healthy",
+			expectedRevision:      "main@sha1:abc",
+			expectedPhase:         "Succeeded",
+			expectedResourceState: "Healthy",
+		},
+		{
+			name:                  "demo-api-chart",
+			expectedSync:          "OutOfSync",
+			expectedHealth:        "Progressing",
+			expectedRevision:      "1.1.0",
+			expectedPhase:         "Failed",
+			expectedResourceState: "Progressing",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			application := applications.Items[i]
+			if application.GetName() != tt.name || application.GetLabels()["elvia.no/cluster-type"] != "aks" {
+				t.Fatalf("List() returned %s with labels %v, expected %s", application.GetName(), application.GetLabels(), tt.name)
+			}
+
+			syncStatus, _, _ := unstructured.NestedString(application.Object, "status", "sync", "status")
+			healthStatus, _, _ := unstructured.NestedString(application.Object, "status", "health", "status")
+			revision, _, _ := unstructured.NestedString(application.Object, "status", "sync", "revision")
+			phase, _, _ := unstructured.NestedString(application.Object, "status", "operationState", "phase")
+			images, _, _ := unstructured.NestedStringSlice(application.Object, "status", "summary", "images")
+
+			if syncStatus != tt.expectedSync || healthStatus != tt.expectedHealth {
+				t.Errorf("List() status = %s/%s, expected %s/%s", syncStatus, healthStatus, tt.expectedSync, tt.expectedHealth)
+			}
+
+			if revision != tt.expectedRevision || phase != tt.expectedPhase {
+				t.Errorf("List() revision = %s, phase = %s, expected %s, %s", revision, phase, tt.expectedRevision, tt.expectedPhase)
+			}
+
+			if len(images) != 1 || images[0] != fluxImage {
+				t.Errorf("List() images = %v, expected [%s]", images, fluxImage)
+			}
+
+			resources := GetApplicationResources(&application)
+			if len(resources) != 1 || resources[0].HealthStatus != tt.expectedResourceState {
+				t.Errorf("List() resources = %v, expected a %s deployment", resources, tt.expectedResourceState)
+			}
+		})
+	}
+}
+
+func TestFluxStaleReadyCondition(t *testing.T) {
+	client := newFluxClient(
+		newKustomization("core-demo-api-dev-aks", map[string]any{
+			"type":               "Ready",
+			"status":             "True",
+			"reason":             "ReconciliationSucceeded",
+			"observedGeneration": int64(1),
+		}),
+		newDeployment("core", "demo-api", nil, 2),
+	)
+
+	applications, err := NewFlux(client, "flux-system").List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(applications.Items) != 1 {
+		t.Fatalf("List() returned %v, error = %v, expected 1 application", applications, err)
+	}
+
+	application := applications.Items[0]
+
+	syncStatus, _, _ := unstructured.NestedString(application.Object, "status", "sync", "status")
+	healthStatus, _, _ := unstructured.NestedString(application.Object, "status", "health", "status")
+	_, hasOperationState, _ := unstructured.NestedMap(application.Object, "status", "operationState")
+
+	if syncStatus != "OutOfSync" || healthStatus != "Progressing" || hasOperationState {
+		t.Errorf(
+			"List() status = %s/%s, operation state = %t, expected a Ready condition of generation 1 to be progressing for generation 2",
+			syncStatus, healthStatus, hasOperationState,
+		)
+	}
+}
+
+func TestFluxWatch(t *testing.T) {
+	defer func(interval time.Duration) { fluxResyncInterval = interval }(fluxResyncInterval)
+	fluxResyncInterval = 50 * time.Millisecond
+
+	kustomization := newKustomization("core-demo-api-dev-aks", map[string]any{"type": "Ready", "status": "True"})
+	deployment := newDeployment("core", "demo-api", nil, 1)
+	client := newFluxClient(kustomization, deployment)
+
+	w, err := NewFlux(client, "flux-system").Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: "metadata.namespace=flux-system,metadata.name=core-demo-api-dev-aks",
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	defer w.Stop()
+
+	nextHealthStatus := func() string {
+		select {
+		case evt := <-w.ResultChan():
+			healthStatus, _, _ := unstructured.NestedString(evt.Object.(*unstructured.Unstructured).Object, "status", "health", "status")
+
+			return healthStatus
+		case <-time.After(5 * time.Second):
+			t.Fatal("Watch() did not return an event")
+
+			return ""
+		}
+	}
+
+	// The Kustomization is ready without health checks, but its Deployment has not rolled out yet.
+	if _, err := client.Resource(KustomizationGVR).Namespace("flux-system").Update(
+		context.Background(),
+		kustomization,
+		metav1.UpdateOptions{},
+	); err != nil {
+		t.Fatalf("Failed to update kustomization: %v", err)
+	}
+
+	if healthStatus := nextHealthStatus(); healthStatus != "Progressing" {
+		t.Fatalf("Watch() health = %s, expected Progressing", healthStatus)
+	}
+
+	// The rollout does not change the Kustomization, so it is only noticed when converting it again.
+	deployment = newDeployment("core", "demo-api", nil, 2)
+	if _, err := client.Resource(DeploymentGVR).Namespace("core").Update(
+		context.Background(),
+		deployment,
+		metav1.UpdateOptions{},
+	); err != nil {
+		t.Fatalf("Failed to update deployment: %v", err)
+	}
+
+	if healthStatus := nextHealthStatus(); healthStatus != "Healthy" {
+		t.Errorf("Watch() health = %s, expected Healthy", healthStatus)
+	}
+
+	w.Stop()
+
+	for range w.ResultChan() {
+	}
+}
+
+func TestFluxWatchNotFound(t *testing.T) {
+	client := newFluxClient()
+
+	if _, err := NewFlux(client, "flux-system").Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: "metadata.namespace=flux-system,metadata.name=core-demo-api-dev-aks",
+	}); err == nil {
+		t.Error("Watch() returned no error, expected the missing Kustomization or HelmRelease to be reported")
+	}
+}
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/informer"
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	BackendArgoCD = "argocd"
+	BackendFlux   = "flux"
+)
+
+// ClusterConfig configures a management cluster running Argo CD or Flux, read from the 'clusters' of the config file.
+type ClusterConfig struct {
+	Name string `json:"name"`
+	// Cluster types whose applications are managed by this Argo CD, e.g. 'aks'; empty means all cluster types.
+	ClusterTypes []string `json:"cluster_types,omitempty"`
+	// Environments whose applications are managed by this cluster, e.g. 'dev'; empty means all environments.
+	Environments []string `json:"environments,omitempty"`
+	// Either 'argocd' (the default) or 'flux', which checks Kustomizations and HelmReleases instead of applications.
+	Backend string `json:"backend,omitempty"`
+	// Path to a kubeconfig, e.g. mounted from a secret; the cluster deployvia runs in is used if both this and 'context' are empty.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context in the kubeconfig; its current context is used if empty.
+	Context string `json:"context,omitempty"`
+	// Namespaces to look for applications in, defaulting to APPLICATION_NAMESPACES, or 'flux-system' for Flux.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// URL of the Argo CD API server, e.g. 'https://argocd.example.com'; if set, applications are read from its REST API
+	// instead of the Kubernetes API, which is then only used for ApplicationSets and actions if 'kubeconfig' or 'context' is set.
+	ArgoCDServer string `json:"argocd_server,omitempty"`
+	// Path to a file with an Argo CD API token, e.g. mounted from a secret; ARGOCD_AUTH_TOKEN is used if empty.
+	ArgoCDTokenFile string `json:"argocd_token_file,omitempty"`
+	// Clusters Argo CD deploys to, for verifying workloads; the management cluster itself needs no entry.
+	Destinations []DestinationConfig `json:"destinations,omitempty"`
+}
+
+// DestinationConfig gives access to a cluster Argo CD deploys to, matched by the 'spec.destination' of applications.
+type DestinationConfig struct {
+	// Either the server or the name of the destination, as in 'spec.destination'.
+	Server string `json:"server,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Path to a kubeconfig, and the context in it, as for the cluster.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+}
+
+// Cluster is a management cluster running Argo CD or Flux, whose applications deployvia checks.
+type Cluster struct {
+	// Empty if only the cluster deployvia runs in is configured.
+	Name         string
+	ClusterTypes []string
+	Environments []string
+	// Empty for Argo CD.
+	Backend string
+	// Namespaces to look for applications in; a single empty namespace means all namespaces.
+	ApplicationNamespaces []string
+	// Nil if applications are read from the Argo CD API without access to the Kubernetes API.
+	KubernetesClient dynamic.Interface
+	// Used for reading pod logs of the workloads deployed to the cluster, nil like the client.
+	KubernetesClientset kubernetes.Interface
+	// Set if applications are read from the Argo CD API instead of the Kubernetes API.
+	ArgoCD *backend.ArgoCD
+	// Shared caches of applications keyed by namespace, nil if disabled.
+	ApplicationInformers map[string]*informer.ApplicationInformer
+	// Shared caches of ApplicationSets keyed by namespace, nil like the applications.
+	ApplicationSetInformers map[string]*informer.ApplicationInformer
+	// Clusters Argo CD deploys to, keyed by destination server and name.
+	Destinations map[string]*Destination
+}
+
+// Destination is a cluster Argo CD deploys to.
+type Destination struct {
+	KubernetesClient    dynamic.Interface
+	KubernetesClientset kubernetes.Interface
+}
+
+// Manages returns true if this cluster's Argo CD manages applications of the cluster type.
+func (c *Cluster) Manages(clusterType string) bool {
+	return len(c.ClusterTypes) == 0 || slices.Contains(c.ClusterTypes, clusterType)
+}
+
+// ManagesEnvironment returns true if this cluster manages applications of the environment.
+func (c *Cluster) ManagesEnvironment(environment string) bool {
+	return len(c.Environments) == 0 || slices.Contains(c.Environments, environment)
+}
+
+// IsFlux returns true if the cluster runs Flux instead of Argo CD.
+func (c *Cluster) IsFlux() bool {
+	return c.Backend == BackendFlux
+}
+
+// ArgoCDClient returns the client for patching Argo CD applications and reading ApplicationSets,
+// nil if the cluster runs Flux or is only read through the Argo CD API.
+func (c *Cluster) ArgoCDClient() dynamic.Interface {
+	if c.IsFlux() {
+		return nil
+	}
+
+	return c.KubernetesClient
+}
+
+// WorkloadClients returns the clients for the cluster an application is deployed to, given its destination server or name,
+// and nil if deployvia has no access to it. Flux deploys to the cluster it runs in.
+func (c *Cluster) WorkloadClients(server string, name string) (dynamic.Interface, kubernetes.Interface) {
+	if c.IsFlux() || server == "https://kubernetes.default.svc" || name == "in-cluster" || (server == "" && name == "") {
+		return c.KubernetesClient, c.KubernetesClientset
+	}
+
+	destination, ok := c.Destinations[cmp.Or(server, name)]
+	if !ok {
+		return nil, nil
+	}
+
+	return destination.KubernetesClient, destination.KubernetesClientset
+}
+
+// GetClusters returns the clusters to check for a deployment in its environment; all of them if it checks all cluster types.
+func (c *Config) GetClusters(deployment *model.Deployment) []*Cluster {
+	var clusters []*Cluster
+	for _, cluster := range c.Clusters {
+		if cluster.ManagesEnvironment(deployment.Environment) &&
+			(deployment.CheckAllClusters || cluster.Manages(deployment.ClusterType)) {
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	return clusters
+}
+
+// Creates a client for each configured cluster, starting their application informers.
+// Without any configured clusters, only the cluster deployvia runs in is checked, for all cluster types.
+func configureClusters(
+	ctx context.Context,
+	fileConfig *fileConfig,
+	localClient dynamic.Interface,
+	localClientset kubernetes.Interface,
+	applicationNamespaces []string,
+) ([]*Cluster, error) {
+	if len(fileConfig.Clusters) == 0 {
+		applicationInformers, applicationSetInformers, err := configureApplicationInformers(ctx, localClient, applicationNamespaces)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Cluster{
+			{
+				ApplicationNamespaces:   applicationNamespaces,
+				KubernetesClient:        localClient,
+				KubernetesClientset:     localClientset,
+				ApplicationInformers:    applicationInformers,
+				ApplicationSetInformers: applicationSetInformers,
+			},
+		}, nil
+	}
+
+	var clusters []*Cluster
+	for _, clusterConfig := range fileConfig.Clusters {
+		if clusterConfig.Name == "" {
+			return nil, fmt.Errorf("cluster is missing a name")
+		}
+
+		if slices.ContainsFunc(clusters, func(c *Cluster) bool { return c.Name == clusterConfig.Name }) {
+			return nil, fmt.Errorf("cluster %s is configured more than once", clusterConfig.Name)
+		}
+
+		switch clusterConfig.Backend {
+		case "", BackendArgoCD:
+		case BackendFlux:
+			if clusterConfig.ArgoCDServer != "" {
+				return nil, fmt.Errorf("cluster %s: argocd_server can not be used with the flux backend", clusterConfig.Name)
+			}
+		default:
+			return nil, fmt.Errorf("cluster %s: unknown backend %s", clusterConfig.Name, clusterConfig.Backend)
+		}
+
+		namespaces := clusterConfig.Namespaces
+		if len(namespaces) == 0 {
+			namespaces = applicationNamespaces
+			if clusterConfig.Backend == BackendFlux {
+				namespaces = []string{"flux-system"}
+			}
+		}
+
+		cluster := &Cluster{
+			Name:                  clusterConfig.Name,
+			ClusterTypes:          clusterConfig.ClusterTypes,
+			Environments:          clusterConfig.Environments,
+			Backend:               clusterConfig.Backend,
+			ApplicationNamespaces: namespaces,
+		}
+
+		// The cluster deployvia runs in is not the management cluster when reading from a remote Argo CD API.
+		if clusterConfig.ArgoCDServer == "" {
+			cluster.KubernetesClient = localClient
+			cluster.KubernetesClientset = localClientset
+		}
+
+		if clusterConfig.Kubeconfig != "" || clusterConfig.Context != "" {
+			client, clientset, err := newClusterClient(clusterConfig.Kubeconfig, clusterConfig.Context)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", clusterConfig.Name, err)
+			}
+
+			cluster.KubernetesClient = client
+			cluster.KubernetesClientset = clientset
+		}
+
+		destinations, err := configureDestinations(clusterConfig.Destinations)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", clusterConfig.Name, err)
+		}
+
+		cluster.Destinations = destinations
+
+		if clusterConfig.ArgoCDServer != "" {
+			argoCD, err := newArgoCDBackend(clusterConfig, namespaces)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", clusterConfig.Name, err)
+			}
+
+			cluster.ArgoCD = argoCD
+
+			log.Infof("Reading applications of cluster %s from the Argo CD API at %s", clusterConfig.Name, clusterConfig.ArgoCDServer)
+		} else if !cluster.IsFlux() {
+			applicationInformers, applicationSetInformers, err := configureApplicationInformers(ctx, cluster.KubernetesClient, namespaces)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", clusterConfig.Name, err)
+			}
+
+			cluster.ApplicationInformers = applicationInformers
+			cluster.ApplicationSetInformers = applicationSetInformers
+		}
+
+		log.Infof(
+			"Checking applications of cluster types %v and environments %v in cluster %s",
+			clusterConfig.ClusterTypes,
+			clusterConfig.Environments,
+			clusterConfig.Name,
+		)
+
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+// Creates a client for each destination, keyed by both its server and name.
+func configureDestinations(destinationConfigs []DestinationConfig) (map[string]*Destination, error) {
+	destinations := make(map[string]*Destination, len(destinationConfigs))
+	for _, destinationConfig := range destinationConfigs {
+		if destinationConfig.Server == "" && destinationConfig.Name == "" {
+			return nil, fmt.Errorf("destination is missing a server or name")
+		}
+
+		client, clientset, err := newClusterClient(destinationConfig.Kubeconfig, destinationConfig.Context)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", cmp.Or(destinationConfig.Server, destinationConfig.Name), err)
+		}
+
+		destination := &Destination{KubernetesClient: client, KubernetesClientset: clientset}
+		for _, key := range []string{destinationConfig.Server, destinationConfig.Name} {
+			if key != "" {
+				destinations[key] = destination
+			}
+		}
+	}
+
+	return destinations, nil
+}
+
+// Creates clients for a context in a kubeconfig, using the default loading rules if no kubeconfig is given.
+func newClusterClient(kubeconfig string, kubeContext string) (dynamic.Interface, kubernetes.Interface, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+
+	kubernetesConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	client, err := dynamic.NewForConfig(kubernetesConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubernetesConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, clientset, nil
+}
+
+// Creates a backend for the Argo CD API, with the token from the configured file or ARGOCD_AUTH_TOKEN.
+func newArgoCDBackend(clusterConfig ClusterConfig, namespaces []string) (*backend.ArgoCD, error) {
+	if _, err := url.ParseRequestURI(clusterConfig.ArgoCDServer); err != nil {
+		return nil, fmt.Errorf("invalid argocd_server: %w", err)
+	}
+
+	token := os.Getenv("ARGOCD_AUTH_TOKEN")
+	if clusterConfig.ArgoCDTokenFile != "" {
+		tokenFile, err := os.ReadFile(clusterConfig.ArgoCDTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read argocd_token_file: %w", err)
+		}
+
+		token = strings.TrimSpace(string(tokenFile))
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("argocd_token_file or ARGOCD_AUTH_TOKEN is required with argocd_server")
+	}
+
+	return backend.NewArgoCD(clusterConfig.ArgoCDServer, token, namespaces, nil), nil
+}
@@ -2,35 +2,73 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/3lvia/deployvia/internal/job"
+	"github.com/3lvia/deployvia/internal/model"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 )
 
 type Config struct {
-	Environment        string
-	GitHubOIDCURL      string
-	KubernetesClient   *dynamic.DynamicClient
+	Environment         string
+	IdentityProviders   []model.IdentityProvider
+	ReplayProtection    *model.ReplayProtection
+	KubernetesClient    *dynamic.DynamicClient
+	KubernetesClientset *kubernetes.Clientset
+	// Management clusters running Argo CD, with at least the cluster deployvia runs in.
+	Clusters           []*Cluster
 	ApplicationMetrics *ApplicationMetrics
-	Local              bool
-	Port               string
+	Jobs               *job.Registry
+	Policy             *model.Policy
+	MaxTimeout         time.Duration
+	// How long rolling an application back may take, after its deployment failed or timed out.
+	RollbackTimeout time.Duration
+	Local           bool
+	Port            string
 }
 
 func New(ctx context.Context) (*Config, error) {
-	const GITHUB_OIDC_URL = "https://token.actions.githubusercontent.com/.well-known/jwks"
+	fileConfig, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
 
 	applicationMetrics, err := ConfigureOpenTelemetry(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	k8sClient, err := configureKubernetesClient(os.Getenv("LOCAL") == "true")
+	k8sClient, k8sClientset, err := configureKubernetesClient(os.Getenv("LOCAL") == "true")
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := configureClusters(ctx, fileConfig, k8sClient, k8sClientset, configureApplicationNamespaces())
+	if err != nil {
+		return nil, err
+	}
+
+	identityProviders, err := configureIdentityProviders(ctx, fileConfig, applicationMetrics, k8sClientset)
+	if err != nil {
+		return nil, err
+	}
+
+	replayProtection, err := configureReplayProtection(applicationMetrics)
 	if err != nil {
 		return nil, err
 	}
 
 	local := os.Getenv("LOCAL") == "true"
 
+	policy, err := configurePolicy(ctx, k8sClient)
+	if err != nil {
+		return nil, err
+	}
+
 	port := func() string {
 		port_ := os.Getenv("PORT")
 		if port_ == "" {
@@ -40,11 +78,86 @@ func New(ctx context.Context) (*Config, error) {
 		return port_
 	}()
 
+	jobRetention, err := func() (time.Duration, error) {
+		const defaultJobRetention = 1 * time.Hour
+
+		jobRetention_ := os.Getenv("JOB_RETENTION")
+		if jobRetention_ == "" {
+			return defaultJobRetention, nil
+		}
+
+		jobRetention, err := time.ParseDuration(jobRetention_)
+		if err != nil {
+			return 0, fmt.Errorf("invalid JOB_RETENTION: %w", err)
+		}
+
+		return jobRetention, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	maxTimeout, err := func() (time.Duration, error) {
+		const defaultMaxTimeout = 30 * time.Minute
+
+		maxTimeout_ := os.Getenv("MAX_TIMEOUT")
+		if maxTimeout_ == "" {
+			return defaultMaxTimeout, nil
+		}
+
+		maxTimeout, err := time.ParseDuration(maxTimeout_)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MAX_TIMEOUT: %w", err)
+		}
+
+		return maxTimeout, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	rollbackTimeout, err := func() (time.Duration, error) {
+		const defaultRollbackTimeout = 5 * time.Minute
+
+		rollbackTimeout_ := os.Getenv("ROLLBACK_TIMEOUT")
+		if rollbackTimeout_ == "" {
+			return defaultRollbackTimeout, nil
+		}
+
+		rollbackTimeout, err := time.ParseDuration(rollbackTimeout_)
+		if err != nil || rollbackTimeout <= 0 {
+			return 0, fmt.Errorf("invalid ROLLBACK_TIMEOUT: %s", rollbackTimeout_)
+		}
+
+		return rollbackTimeout, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	maxRunningJobs := 100
+	if maxRunningJobs_ := os.Getenv("MAX_RUNNING_JOBS"); maxRunningJobs_ != "" {
+		maxRunningJobs, err = strconv.Atoi(maxRunningJobs_)
+		if err != nil || maxRunningJobs <= 0 {
+			return nil, fmt.Errorf("invalid MAX_RUNNING_JOBS: %s", maxRunningJobs_)
+		}
+	}
+
+	jobs := job.NewRegistry(jobRetention, maxRunningJobs)
+	go jobs.Run(ctx)
+
 	return &Config{
-		KubernetesClient:   k8sClient,
-		GitHubOIDCURL:      GITHUB_OIDC_URL,
-		ApplicationMetrics: applicationMetrics,
-		Local:              local,
-		Port:               port,
+		KubernetesClient:    k8sClient,
+		KubernetesClientset: k8sClientset,
+		Clusters:            clusters,
+		IdentityProviders:   identityProviders,
+		ReplayProtection:    replayProtection,
+		ApplicationMetrics:  applicationMetrics,
+		Jobs:                jobs,
+		Policy:              policy,
+		MaxTimeout:          maxTimeout,
+		RollbackTimeout:     rollbackTimeout,
+		Local:               local,
+		Port:                port,
 	}, nil
 }
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"sigs.k8s.io/yaml"
+)
+
+// fileConfig is the optional YAML configuration file given by CONFIG_FILE, for settings that don't fit in environment variables.
+type fileConfig struct {
+	TrustedIssuers     []model.TrustedIssuer     `json:"trusted_issuers,omitempty"`
+	ServiceAccountAuth *model.ServiceAccountAuth `json:"service_account_auth,omitempty"`
+	Clusters           []ClusterConfig           `json:"clusters,omitempty"`
+}
+
+func readConfigFile() (*fileConfig, error) {
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		return &fileConfig{}, nil
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fileConfig_ fileConfig
+	if err := yaml.UnmarshalStrict(data, &fileConfig_); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return &fileConfig_, nil
+}
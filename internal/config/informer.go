@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"os"
+
+	"github.com/3lvia/deployvia/internal/informer"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	applicationGVR = schema.GroupVersionResource{
+		Group:    "argoproj.io",
+		Version:  "v1alpha1",
+		Resource: "applications",
+	}
+	applicationSetGVR = applicationGVR.GroupVersion().WithResource("applicationsets")
+)
+
+// Starts a shared cache of Argo CD applications and ApplicationSets for each namespace, unless APPLICATION_INFORMER is set to 'false'.
+// Without it, every request lists and watches the API server directly.
+func configureApplicationInformers(
+	ctx context.Context,
+	client dynamic.Interface,
+	namespaces []string,
+) (map[string]*informer.ApplicationInformer, map[string]*informer.ApplicationInformer, error) {
+	if os.Getenv("APPLICATION_INFORMER") == "false" {
+		log.Warn("APPLICATION_INFORMER is set to false, requests will list and watch applications directly")
+
+		return nil, nil, nil
+	}
+
+	applicationInformers, err := startInformers(ctx, client, applicationGVR, namespaces)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	applicationSetInformers, err := startInformers(ctx, client, applicationSetGVR, namespaces)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return applicationInformers, applicationSetInformers, nil
+}
+
+func startInformers(
+	ctx context.Context,
+	client dynamic.Interface,
+	gvr schema.GroupVersionResource,
+	namespaces []string,
+) (map[string]*informer.ApplicationInformer, error) {
+	informers := make(map[string]*informer.ApplicationInformer, len(namespaces))
+	for _, namespace := range namespaces {
+		i, err := informer.New(client, gvr, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		go i.Run(ctx)
+
+		informers[namespace] = i
+	}
+
+	return informers, nil
+}
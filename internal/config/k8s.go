@@ -5,23 +5,29 @@ import (
 	"path/filepath"
 
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
-func configureKubernetesClient(local bool) (*dynamic.DynamicClient, error) {
+func configureKubernetesClient(local bool) (*dynamic.DynamicClient, *kubernetes.Clientset, error) {
 	kubernetesConfig, err := configureKubernetesConfig(local)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	dynamicClient, err := dynamic.NewForConfig(kubernetesConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return dynamicClient, nil
+	clientset, err := kubernetes.NewForConfig(kubernetesConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return dynamicClient, clientset, nil
 }
 
 func configureKubernetesConfig(local bool) (*rest.Config, error) {
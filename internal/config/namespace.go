@@ -0,0 +1,32 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Returns the namespaces to look for Argo CD applications in, from the comma-separated APPLICATION_NAMESPACES.
+// Defaults to the Argo CD control-plane namespace 'argocd'; '*' means all namespaces, which requires the ClusterRole variant of the manifests.
+func configureApplicationNamespaces() []string {
+	applicationNamespaces := os.Getenv("APPLICATION_NAMESPACES")
+	if applicationNamespaces == "" {
+		return []string{"argocd"}
+	}
+
+	var namespaces []string
+	for _, namespace := range strings.Split(applicationNamespaces, ",") {
+		namespace = strings.TrimSpace(namespace)
+
+		if namespace == "*" {
+			return []string{metav1.NamespaceAll}
+		}
+
+		if namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces
+}
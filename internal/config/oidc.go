@@ -0,0 +1,173 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	meter "go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Creates the identity providers for the trusted issuers from the config file,
+// or a single trusted issuer from the OIDC_* environment variables, which default to GitHub Actions for the 3lvia organization.
+// ServiceAccount authentication is enabled by the config file or SERVICE_ACCOUNT_AUTH_AUDIENCES.
+func configureIdentityProviders(
+	ctx context.Context,
+	fileConfig *fileConfig,
+	applicationMetrics *ApplicationMetrics,
+	clientset kubernetes.Interface,
+) ([]model.IdentityProvider, error) {
+	trustedIssuers := fileConfig.TrustedIssuers
+	if len(trustedIssuers) == 0 {
+		trustedIssuers = []model.TrustedIssuer{
+			{
+				Name:          "default",
+				Provider:      getEnvOrDefault("OIDC_PROVIDER", model.IdentityProviderGitHubActions),
+				Issuer:        getEnvOrDefault("OIDC_ISSUER", "https://token.actions.githubusercontent.com"),
+				JWKSURL:       getEnvOrDefault("OIDC_JWKS_URL", "https://token.actions.githubusercontent.com/.well-known/jwks"),
+				Audiences:     strings.Split(getEnvOrDefault("OIDC_AUDIENCES", "https://github.com/3lvia"), ","),
+				AllowedOwners: strings.Split(getEnvOrDefault("OIDC_ALLOWED_OWNERS", "3lvia"), ","),
+			},
+		}
+	}
+
+	for i := range trustedIssuers {
+		if err := model.ValidateTrustedIssuer(&trustedIssuers[i]); err != nil {
+			return nil, err
+		}
+
+		k, err := configureKeyfunc(ctx, trustedIssuers[i].JWKSURL, applicationMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("trusted issuer %s: %w", trustedIssuers[i].Name, err)
+		}
+
+		trustedIssuers[i].Keyfunc = k
+	}
+
+	identityProviders, err := model.NewIdentityProviders(trustedIssuers)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceAccountAuth := fileConfig.ServiceAccountAuth
+	if serviceAccountAuth == nil && os.Getenv("SERVICE_ACCOUNT_AUTH_AUDIENCES") != "" {
+		serviceAccountAuth = &model.ServiceAccountAuth{
+			Audiences: strings.Split(os.Getenv("SERVICE_ACCOUNT_AUTH_AUDIENCES"), ","),
+		}
+
+		if allowedNamespaces := os.Getenv("SERVICE_ACCOUNT_AUTH_ALLOWED_NAMESPACES"); allowedNamespaces != "" {
+			serviceAccountAuth.AllowedNamespaces = strings.Split(allowedNamespaces, ",")
+		}
+	}
+
+	if serviceAccountAuth != nil {
+		kubernetesProvider, err := model.NewKubernetesProvider(clientset, *serviceAccountAuth)
+		if err != nil {
+			return nil, err
+		}
+
+		identityProviders = append(identityProviders, kubernetesProvider)
+	}
+
+	return identityProviders, nil
+}
+
+func getEnvOrDefault(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// Creates a long-lived JWKS cache shared by all requests.
+// The key set is refreshed in the background, and on demand (rate-limited) when a token has an unknown key ID.
+func configureKeyfunc(
+	ctx context.Context,
+	jwksURL string,
+	applicationMetrics *ApplicationMetrics,
+) (keyfunc.Keyfunc, error) {
+	storage, err := jwkset.NewStorageFromHTTP(
+		jwksURL,
+		jwkset.HTTPClientStorageOptions{
+			Ctx:                       ctx,
+			HTTPTimeout:               10 * time.Second,
+			NoErrorReturnFirstHTTPReq: true,
+			RefreshInterval:           time.Hour,
+			RefreshErrorHandler: func(ctx context.Context, err error) {
+				log.Errorf("Failed to refresh JWKS from %s: %v", jwksURL, err)
+
+				applicationMetrics.jwksRefreshFailuresTotal.Add(
+					ctx,
+					1,
+					meter.WithAttributes(attribute.Key("url").String(jwksURL)),
+				)
+			},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS storage: %w", err)
+	}
+
+	client, err := jwkset.NewHTTPClient(jwkset.HTTPClientOptions{
+		HTTPURLs:          map[string]jwkset.Storage{jwksURL: storage},
+		RateLimitWaitMax:  10 * time.Second,
+		RefreshUnknownKID: rate.NewLimiter(rate.Every(time.Minute), 1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS client: %w", err)
+	}
+
+	k, err := keyfunc.New(keyfunc.Options{
+		Ctx:     ctx,
+		Storage: client,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyfunc: %w", err)
+	}
+
+	return k, nil
+}
+
+// Configures replay protection from TOKEN_REPLAY_POLICY (off, warn or reject; default off),
+// storing up to TOKEN_REPLAY_CACHE_SIZE token IDs in memory.
+func configureReplayProtection(applicationMetrics *ApplicationMetrics) (*model.ReplayProtection, error) {
+	policy, err := model.ParseReplayPolicy(os.Getenv("TOKEN_REPLAY_POLICY"))
+	if err != nil {
+		return nil, err
+	}
+
+	cacheSize := 10000
+	if cacheSize_ := os.Getenv("TOKEN_REPLAY_CACHE_SIZE"); cacheSize_ != "" {
+		cacheSize, err = strconv.Atoi(cacheSize_)
+		if err != nil || cacheSize <= 0 {
+			return nil, fmt.Errorf("invalid TOKEN_REPLAY_CACHE_SIZE: %s", cacheSize_)
+		}
+	}
+
+	return &model.ReplayProtection{
+		Policy: policy,
+		Store:  model.NewMemoryReplayStore(cacheSize),
+		OnReplay: func(ctx context.Context, identity *model.CallerIdentity) {
+			applicationMetrics.tokenReplaysTotal.Add(
+				ctx,
+				1,
+				meter.WithAttributes(
+					attribute.Key("provider").String(identity.Provider),
+					attribute.Key("policy").String(string(policy)),
+				),
+			)
+		},
+	}, nil
+}
@@ -24,6 +24,9 @@ import (
 type ApplicationMetrics struct {
 	httpRequestsReceivedTotal  meter.Int64Counter
 	httpRequestDurationSeconds meter.Float64Histogram
+	jwksRefreshFailuresTotal   meter.Int64Counter
+	tokenReplaysTotal          meter.Int64Counter
+	watchReconnectsTotal       meter.Int64Counter
 }
 
 const (
@@ -127,12 +130,51 @@ func configureMetrics(ctx context.Context, resource *resource.Resource) (*Applic
 		return nil, fmt.Errorf("could not create histogram: %s", err)
 	}
 
+	jwksRefreshFailuresTotal, err := metrics.Int64Counter(
+		"jwks_refresh_failures_total",
+		meter.WithDescription("Total number of failed JWKS refreshes"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create counter: %s", err)
+	}
+
+	tokenReplaysTotal, err := metrics.Int64Counter(
+		"token_replays_total",
+		meter.WithDescription("Total number of requests reusing an already used token"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create counter: %s", err)
+	}
+
+	watchReconnectsTotal, err := metrics.Int64Counter(
+		"watch_reconnects_total",
+		meter.WithDescription("Total number of application watches resumed after being closed"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create counter: %s", err)
+	}
+
 	return &ApplicationMetrics{
 		httpRequestsReceivedTotal:  httpRequestsReceivedTotal,
 		httpRequestDurationSeconds: httpRequestDurationSeconds,
+		jwksRefreshFailuresTotal:   jwksRefreshFailuresTotal,
+		tokenReplaysTotal:          tokenReplaysTotal,
+		watchReconnectsTotal:       watchReconnectsTotal,
 	}, nil
 }
 
+func (m *ApplicationMetrics) RecordWatchReconnect(ctx context.Context, namespace string) {
+	if m == nil {
+		return
+	}
+
+	m.watchReconnectsTotal.Add(
+		ctx,
+		1,
+		meter.WithAttributes(attribute.Key("namespace").String(namespace)),
+	)
+}
+
 func ConfigureMetrics(conf *Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		t := time.Now()
@@ -141,7 +183,11 @@ func ConfigureMetrics(conf *Config) gin.HandlerFunc {
 		latency := time.Since(t)
 		statusCode := c.Writer.Status()
 		method := c.Request.Method
-		endpoint := c.Request.URL.Path
+		// The route template, e.g. '/deployment/:id', keeps the number of distinct endpoints bounded.
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = "unmatched"
+		}
 
 		meterAttributes := []attribute.KeyValue{
 			attribute.Key("code").Int(statusCode),
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Loads the authorization policy from the file in POLICY_FILE, or from the ConfigMap in POLICY_CONFIGMAP (namespace/name).
+// Returns nil if neither is set, which allows every validated caller.
+func configurePolicy(ctx context.Context, client dynamic.Interface) (*model.Policy, error) {
+	policyFile := os.Getenv("POLICY_FILE")
+	policyConfigMap := os.Getenv("POLICY_CONFIGMAP")
+
+	switch {
+	case policyFile != "" && policyConfigMap != "":
+		return nil, fmt.Errorf("only one of POLICY_FILE and POLICY_CONFIGMAP can be set")
+	case policyFile != "":
+		data, err := os.ReadFile(policyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy file: %w", err)
+		}
+
+		return model.ParsePolicy(data)
+	case policyConfigMap != "":
+		data, err := readPolicyConfigMap(ctx, client, policyConfigMap)
+		if err != nil {
+			return nil, err
+		}
+
+		return model.ParsePolicy(data)
+	default:
+		log.Warn("No authorization policy configured; every validated caller can query every application")
+
+		return nil, nil
+	}
+}
+
+func readPolicyConfigMap(ctx context.Context, client dynamic.Interface, policyConfigMap string) ([]byte, error) {
+	namespace, name, found := strings.Cut(policyConfigMap, "/")
+	if !found || namespace == "" || name == "" {
+		return nil, fmt.Errorf("POLICY_CONFIGMAP must be in the format namespace/name")
+	}
+
+	key := func() string {
+		key_ := os.Getenv("POLICY_CONFIGMAP_KEY")
+		if key_ == "" {
+			return "policy.yaml"
+		}
+
+		return key_
+	}()
+
+	gvr := schema.GroupVersionResource{
+		Version:  "v1",
+		Resource: "configmaps",
+	}
+
+	configMap, err := client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get policy ConfigMap: %w", err)
+	}
+
+	data, found, err := unstructured.NestedString(configMap.Object, "data", key)
+	if err != nil || !found {
+		return nil, fmt.Errorf("policy ConfigMap %s has no key %s", policyConfigMap, key)
+	}
+
+	return []byte(data), nil
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Returns the current status of every application matching the system, application and query, without waiting for a deployment.
+func GetApplications(
+	ctx context.Context,
+	c *gin.Context,
+	config *config.Config,
+) {
+	identity, ok := authenticate(ctx, c, config)
+	if !ok {
+		return
+	}
+
+	// Reading the status uses the same tokens as deploying, so a leaked token must not be usable here either.
+	if !checkReplay(ctx, c, config, identity) {
+		return
+	}
+
+	deployment := &model.Deployment{
+		System:          c.Param("system"),
+		ApplicationName: c.Param("application"),
+		Environment:     c.Query("environment"),
+		ClusterType:     c.Query("cluster_type"),
+	}
+
+	validatedDeployment, err := model.ValidateApplicationLookup(deployment)
+	if err != nil {
+		err := &model.ValidationError{Err: fmt.Errorf("invalid application: %w", err)}
+		log.Error(err)
+		writeProblem(c, err, nil)
+
+		return
+	}
+
+	if !authorize(c, config, identity, validatedDeployment.Deployment) {
+		return
+	}
+
+	gvr := schema.GroupVersionResource{
+		Group:    "argoproj.io",
+		Version:  "v1alpha1",
+		Resource: "applications",
+	}
+
+	applications, err := listClustersApplications(c.Request.Context(), config, gvr, validatedDeployment)
+	if err != nil {
+		log.Error(err)
+		writeProblem(c, err, nil)
+
+		return
+	}
+
+	c.JSON(200, gin.H{"applications": applications})
+}
+
+// Lists the applications matching the deployment in every cluster managing its cluster type.
+// Like when watching, clusters without matching applications are ignored if another cluster has them.
+func listClustersApplications(
+	ctx context.Context,
+	config *config.Config,
+	gvr schema.GroupVersionResource,
+	validatedDeployment *model.ValidatedDeployment,
+) ([]model.ApplicationSummary, error) {
+	clusters := config.GetClusters(validatedDeployment.Deployment)
+
+	var (
+		summaries []model.ApplicationSummary
+		errs      []error
+	)
+
+	for _, cluster := range clusters {
+		clusterSummaries, err := listApplications(ctx, getApplicationClients(config, cluster, gvr), validatedDeployment)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		for _, summary := range clusterSummaries {
+			summary.Cluster = cluster.Name
+			summaries = append(summaries, summary)
+		}
+	}
+
+	if len(summaries) > 0 {
+		errs = slices.DeleteFunc(errs, isApplicationNotFound)
+	}
+
+	if len(errs) > 0 {
+		return nil, chainErrors(errs)
+	}
+
+	if len(summaries) == 0 {
+		return nil, &model.ApplicationNotFoundError{LabelSelector: getLabelSelector(validatedDeployment)}
+	}
+
+	return summaries, nil
+}
+
+// Lists the applications matching the deployment, sorted by name.
+func listApplications(
+	ctx context.Context,
+	applicationClient backend.StatusBackend,
+	validatedDeployment *model.ValidatedDeployment,
+) ([]model.ApplicationSummary, error) {
+	applications, err := applicationClient.List(
+		ctx,
+		metav1.ListOptions{
+			LabelSelector: getLabelSelector(validatedDeployment),
+		},
+	)
+	if err != nil {
+		return nil, &model.WatchFailedError{Err: fmt.Errorf("failed to list applications: %w", err)}
+	}
+
+	if len(applications.Items) == 0 {
+		return nil, &model.ApplicationNotFoundError{LabelSelector: getLabelSelector(validatedDeployment)}
+	}
+
+	summaries := make([]model.ApplicationSummary, 0, len(applications.Items))
+	for _, application := range applications.Items {
+		summaries = append(summaries, getApplicationSummary(&application))
+	}
+
+	slices.SortFunc(summaries, func(a, b model.ApplicationSummary) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return summaries, nil
+}
+
+func getApplicationSummary(application *unstructured.Unstructured) model.ApplicationSummary {
+	summary := model.ApplicationSummary{
+		Name:        application.GetName(),
+		Namespace:   application.GetNamespace(),
+		ClusterType: application.GetLabels()["elvia.no/cluster-type"],
+	}
+
+	summary.SyncStatus, _, _ = unstructured.NestedString(application.Object, "status", "sync", "status")
+	summary.HealthStatus, _, _ = unstructured.NestedString(application.Object, "status", "health", "status")
+	summary.Images, _, _ = unstructured.NestedStringSlice(application.Object, "status", "summary", "images")
+	summary.Revision, _, _ = unstructured.NestedString(application.Object, "status", "sync", "revision")
+	summary.TargetRevision, _, _ = unstructured.NestedString(application.Object, "spec", "source", "targetRevision")
+
+	// Multi-source applications report a revision per source; the first source is the one with the manifests.
+	if summary.Revision == "" {
+		if revisions, _, _ := unstructured.NestedStringSlice(application.Object, "status", "sync", "revisions"); len(revisions) > 0 {
+			summary.Revision = revisions[0]
+		}
+	}
+
+	if summary.TargetRevision == "" {
+		if sources, _, _ := unstructured.NestedSlice(application.Object, "spec", "sources"); len(sources) > 0 {
+			if source, ok := sources[0].(map[string]any); ok {
+				summary.TargetRevision, _, _ = unstructured.NestedString(source, "targetRevision")
+			}
+		}
+	}
+
+	if finishedAt, _, _ := unstructured.NestedString(application.Object, "status", "operationState", "finishedAt"); finishedAt != "" {
+		if lastSyncedAt, err := time.Parse(time.RFC3339, finishedAt); err == nil {
+			summary.LastSyncedAt = &lastSyncedAt
+		}
+	}
+
+	return summary
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestListApplications(t *testing.T) {
+	newLabeledApplication := func(name string, clusterType string, status map[string]any) *unstructured.Unstructured {
+		application := newApplication(name, nil)
+		application.SetLabels(map[string]string{
+			"elvia.no/system":           "core",
+			"elvia.no/application":      "demo-api",
+			"kubernetes.io/environment": "dev",
+			"elvia.no/cluster-type":     clusterType,
+		})
+		application.Object["status"] = status
+
+		return application
+	}
+
+	gke := newLabeledApplication("core-demo-api-dev-gke", "gke", map[string]any{
+		"sync":    map[string]any{"status": "OutOfSync", "revisions": []any{"def", "ghi"}},
+		"health":  map[string]any{"status": "Progressing"},
+		"summary": map[string]any{"images": []any{"ghcr.io/3lvia/core-demo-api:dev@sha256:2"}},
+	})
+	gke.Object["spec"] = map[string]any{
+		"sources": []any{map[string]any{"targetRevision": "trunk"}},
+	}
+
+	aks := newLabeledApplication("core-demo-api-dev-aks", "aks", map[string]any{
+		"sync":           map[string]any{"status": "Synced", "revision": "abc"},
+		"health":         map[string]any{"status": "Healthy"},
+		"summary":        map[string]any{"images": []any{"ghcr.io/3lvia/core-demo-api:dev@sha256:1"}},
+		"operationState": map[string]any{"finishedAt": "2025-01-02T03:04:05Z"},
+	})
+	aks.Object["spec"] = map[string]any{
+		"source": map[string]any{"targetRevision": "HEAD"},
+	}
+
+	client := newFakeDynamicClient(gke, aks)
+	applicationClient := newKubernetesBackend(client, "argocd")
+
+	validatedDeployment, err := model.ValidateApplicationLookup(&model.Deployment{
+		System:          "core",
+		ApplicationName: "demo-api",
+		Environment:     "dev",
+	})
+	if err != nil {
+		t.Fatalf("ValidateApplicationLookup() error = '%v'", err)
+	}
+
+	applications, err := listApplications(context.Background(), applicationClient, validatedDeployment)
+	if err != nil {
+		t.Fatalf("listApplications() error = '%v'", err)
+	}
+
+	if len(applications) != 2 || applications[0].Name != "core-demo-api-dev-aks" || applications[1].Name != "core-demo-api-dev-gke" {
+		t.Fatalf("listApplications() = %+v, expected aks and gke applications sorted by name", applications)
+	}
+
+	lastSyncedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if aks := applications[0]; aks.Revision != "abc" || aks.TargetRevision != "HEAD" || aks.HealthStatus != "Healthy" ||
+		aks.LastSyncedAt == nil || !aks.LastSyncedAt.Equal(lastSyncedAt) {
+		t.Errorf("listApplications() aks = %+v", aks)
+	}
+
+	if gke := applications[1]; gke.Revision != "def" || gke.TargetRevision != "trunk" || gke.ClusterType != "gke" ||
+		gke.LastSyncedAt != nil {
+		t.Errorf("listApplications() gke = %+v", gke)
+	}
+
+	validatedDeployment.Deployment.ClusterType = "aks"
+	validatedDeployment.Deployment.CheckAllClusters = false
+
+	applications, err = listApplications(context.Background(), applicationClient, validatedDeployment)
+	if err != nil || len(applications) != 1 || applications[0].ClusterType != "aks" {
+		t.Errorf("listApplications() = %+v, '%v', expected only the aks application", applications, err)
+	}
+
+	validatedDeployment.Deployment.Environment = "prod"
+
+	var applicationNotFoundError *model.ApplicationNotFoundError
+	if _, err := listApplications(context.Background(), applicationClient, validatedDeployment); !errors.As(err, &applicationNotFoundError) {
+		t.Errorf("listApplications() error = '%v', expected application not found", err)
+	}
+}
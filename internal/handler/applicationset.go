@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The reasons of ApplicationSet conditions for errors generating the parameters or rendering the template,
+// which keep the ApplicationSet from updating any of its applications.
+var applicationSetGenerationErrorReasons = []string{
+	"ApplicationGenerationFromParamsError",
+	"RenderTemplateParamsError",
+}
+
+// applicationSetListers returns the lister of ApplicationSets in a namespace.
+type applicationSetListers func(namespace string) backend.ApplicationLister
+
+// Returns the listers of ApplicationSets in the cluster, served from the shared cache once it has synced.
+// Returns nil without a Kubernetes client, as the Argo CD API does not expose ApplicationSet conditions.
+func getApplicationSetListers(cluster *config.Cluster, gvr schema.GroupVersionResource) applicationSetListers {
+	client := cluster.ArgoCDClient()
+	if client == nil {
+		return nil
+	}
+
+	return func(namespace string) backend.ApplicationLister {
+		// The cache is not waited for, since it never syncs if e.g. the ApplicationSet CRD is not installed.
+		if applicationSetInformer, ok := cluster.ApplicationSetInformers[namespace]; ok && applicationSetInformer.HasSynced() {
+			return applicationSetInformer
+		}
+
+		return client.Resource(gvr.GroupVersion().WithResource("applicationsets")).Namespace(namespace)
+	}
+}
+
+// applicationSet is an ApplicationSet matching the system and application of a deployment,
+// along with the applications it has generated for the environment.
+type applicationSet struct {
+	name string
+	// Names of the generated applications, sorted.
+	generatedApplications []string
+	conditions            []model.ApplicationSetCondition
+}
+
+// Returns the ApplicationSets labeled with the system and application of the deployment.
+// The applications they generated are found by their owner references, since they may not carry the labels of the ApplicationSet.
+// Returns none without listers, as the Argo CD API does not expose ApplicationSet conditions.
+func getApplicationSets(
+	ctx context.Context,
+	applicationSetListers applicationSetListers,
+	applicationClient backend.StatusBackend,
+	namespaces []string,
+	validatedDeployment *model.ValidatedDeployment,
+) ([]applicationSet, error) {
+	if applicationSetListers == nil {
+		return nil, nil
+	}
+
+	// ApplicationSets can only own applications in their own namespace, so they are looked up in the same namespaces.
+	var applicationSetItems []unstructured.Unstructured
+	for _, namespace := range namespaces {
+		applicationSets, err := applicationSetListers(namespace).List(
+			ctx,
+			metav1.ListOptions{
+				LabelSelector: fmt.Sprintf(
+					"elvia.no/system=%s,elvia.no/application=%s",
+					validatedDeployment.Deployment.System,
+					validatedDeployment.Deployment.ApplicationName,
+				),
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list applicationsets: %w", err)
+		}
+
+		applicationSetItems = append(applicationSetItems, applicationSets.Items...)
+	}
+
+	if len(applicationSetItems) == 0 {
+		return nil, nil
+	}
+
+	// The cluster type is left out, so that applications generated for other clusters are found as well.
+	applications, err := applicationClient.List(
+		ctx,
+		metav1.ListOptions{
+			LabelSelector: fmt.Sprintf(
+				"elvia.no/system=%s,elvia.no/application=%s,kubernetes.io/environment=%s",
+				validatedDeployment.Deployment.System,
+				validatedDeployment.Deployment.ApplicationName,
+				validatedDeployment.Deployment.Environment,
+			),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generated applications: %w", err)
+	}
+
+	var result []applicationSet
+	for _, item := range applicationSetItems {
+		applicationSet := applicationSet{
+			name:       item.GetName(),
+			conditions: getApplicationSetConditions(&item),
+		}
+
+		for _, application := range applications.Items {
+			if !isOwnedBy(&application, &item) {
+				continue
+			}
+
+			applicationSet.generatedApplications = append(applicationSet.generatedApplications, application.GetName())
+		}
+
+		slices.Sort(applicationSet.generatedApplications)
+
+		result = append(result, applicationSet)
+	}
+
+	return result, nil
+}
+
+func isOwnedBy(application *unstructured.Unstructured, owner *unstructured.Unstructured) bool {
+	for _, ownerReference := range application.GetOwnerReferences() {
+		if ownerReference.Kind == "ApplicationSet" && ownerReference.UID == owner.GetUID() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the conditions of the ApplicationSet that report an error.
+// Argo CD sets 'ErrorOccurred' for any error, and clears 'ParametersGenerated' or 'ResourcesUpToDate' depending on where it happened.
+func getApplicationSetConditions(applicationSet *unstructured.Unstructured) []model.ApplicationSetCondition {
+	conditions, _, _ := unstructured.NestedSlice(applicationSet.Object, "status", "conditions")
+
+	var errorConditions []model.ApplicationSetCondition
+	for _, c := range conditions {
+		condition, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		conditionType, _, _ := unstructured.NestedString(condition, "type")
+		status, _, _ := unstructured.NestedString(condition, "status")
+
+		isError := (conditionType == "ErrorOccurred" && status == "True") ||
+			((conditionType == "ParametersGenerated" || conditionType == "ResourcesUpToDate") && status == "False")
+		if !isError {
+			continue
+		}
+
+		reason, _, _ := unstructured.NestedString(condition, "reason")
+		message, _, _ := unstructured.NestedString(condition, "message")
+
+		// The same error is usually reported by several conditions.
+		if slices.ContainsFunc(errorConditions, func(c model.ApplicationSetCondition) bool { return c.Message == message }) {
+			continue
+		}
+
+		errorConditions = append(errorConditions, model.ApplicationSetCondition{
+			Type:    conditionType,
+			Reason:  reason,
+			Message: message,
+		})
+	}
+
+	return errorConditions
+}
+
+// Explains why no application matched the deployment, if an ApplicationSet should have generated it.
+func getApplicationNotGeneratedError(
+	applicationSets []applicationSet,
+	validatedDeployment *model.ValidatedDeployment,
+) error {
+	if len(applicationSets) == 0 {
+		return nil
+	}
+
+	// Prefer an ApplicationSet that has generated applications for other clusters, since that is the one missing a cluster.
+	applicationSet := applicationSets[0]
+	for _, a := range applicationSets {
+		if len(a.generatedApplications) > 0 {
+			applicationSet = a
+			break
+		}
+	}
+
+	notGeneratedErr := &model.ApplicationNotGeneratedError{
+		ApplicationSet:        applicationSet.name,
+		GeneratedApplications: applicationSet.generatedApplications,
+		Conditions:            applicationSet.conditions,
+	}
+
+	if !validatedDeployment.Deployment.CheckAllClusters {
+		notGeneratedErr.ClusterType = validatedDeployment.Deployment.ClusterType
+	}
+
+	return notGeneratedErr
+}
+
+// Returns an error for the first ApplicationSet that generated one of the deployed applications and reports errors affecting them.
+// Other errors, e.g. failing to update another application, are only logged, since they do not keep these applications from being deployed.
+func getApplicationSetError(applicationSets []applicationSet, applicationNames []string) error {
+	for _, applicationSet := range applicationSets {
+		if len(applicationSet.conditions) == 0 {
+			continue
+		}
+
+		generatedApplications := slices.DeleteFunc(slices.Clone(applicationNames), func(name string) bool {
+			return !slices.Contains(applicationSet.generatedApplications, name)
+		})
+		if len(generatedApplications) == 0 {
+			continue
+		}
+
+		var conditions []model.ApplicationSetCondition
+		for _, condition := range applicationSet.conditions {
+			if affectsApplications(condition, generatedApplications) {
+				conditions = append(conditions, condition)
+			} else {
+				log.Warnf("Applicationset %s reports an error not affecting the deployed applications: %s", applicationSet.name, condition)
+			}
+		}
+
+		if len(conditions) == 0 {
+			continue
+		}
+
+		return &model.ApplicationSetFailedError{
+			ApplicationSet: applicationSet.name,
+			Conditions:     conditions,
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the condition keeps the ApplicationSet from updating one of the applications,
+// i.e. it failed to generate any applications, or the error names one of them, e.g. when updating or validating it.
+func affectsApplications(condition model.ApplicationSetCondition, applicationNames []string) bool {
+	if condition.Type == "ParametersGenerated" || slices.Contains(applicationSetGenerationErrorReasons, condition.Reason) {
+		return true
+	}
+
+	return slices.ContainsFunc(applicationNames, func(name string) bool {
+		return mentionsName(condition.Message, name)
+	})
+}
+
+// Returns true if the message contains the name as a whole, not as part of a longer name, e.g. 'api' in 'api-gateway'.
+func mentionsName(message string, name string) bool {
+	isNameCharacter := func(c byte) bool {
+		return c == '-' || c == '.' || c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+
+	for offset := 0; ; {
+		i := strings.Index(message[offset:], name)
+		if i < 0 {
+			return false
+		}
+
+		start, end := offset+i, offset+i+len(name)
+		if (start == 0 || !isNameCharacter(message[start-1])) && (end == len(message) || !isNameCharacter(message[end])) {
+			return true
+		}
+
+		offset = start + 1
+	}
+}
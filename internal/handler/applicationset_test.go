@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newApplicationSet(name string, uid types.UID, conditions []any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "ApplicationSet",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": "argocd",
+			"uid":       string(uid),
+			"labels": map[string]any{
+				"elvia.no/system":      "core",
+				"elvia.no/application": "demo-api",
+			},
+		},
+		"status": map[string]any{
+			"conditions": conditions,
+		},
+	}}
+}
+
+func newGeneratedApplication(name string, clusterType string, owner types.UID) *unstructured.Unstructured {
+	application := newApplication(name, nil)
+	application.SetLabels(map[string]string{
+		"elvia.no/system":           "core",
+		"elvia.no/application":      "demo-api",
+		"kubernetes.io/environment": "dev",
+		"elvia.no/cluster-type":     clusterType,
+	})
+
+	if owner != "" {
+		application.SetOwnerReferences([]metav1.OwnerReference{
+			{
+				APIVersion: "argoproj.io/v1alpha1",
+				Kind:       "ApplicationSet",
+				Name:       "core-demo-api",
+				UID:        owner,
+			},
+		})
+	}
+
+	return application
+}
+
+func TestGetApplicationSets(t *testing.T) {
+	client := newFakeDynamicClient(
+		newApplicationSet("core-demo-api", "uid-1", []any{
+			map[string]any{
+				"type":    "ErrorOccurred",
+				"status":  "True",
+				"reason":  "ApplicationGenerationFromParamsError",
+				"message": "cluster gke not found",
+			},
+			map[string]any{
+				"type":    "ParametersGenerated",
+				"status":  "False",
+				"reason":  "ApplicationGenerationFromParamsError",
+				"message": "cluster gke not found",
+			},
+			map[string]any{
+				"type":    "ResourcesUpToDate",
+				"status":  "True",
+				"reason":  "ApplicationSetUpToDate",
+				"message": "All applications have been generated successfully",
+			},
+		}),
+		newGeneratedApplication("core-demo-api-dev-aks", "aks", "uid-1"),
+		newGeneratedApplication("core-demo-api-dev-manual", "gke", ""),
+	)
+
+	validatedDeployment := &model.ValidatedDeployment{Deployment: &model.Deployment{
+		System:          "core",
+		ApplicationName: "demo-api",
+		Environment:     "dev",
+		ClusterType:     "gke",
+	}}
+
+	applicationSets, err := getApplicationSets(
+		context.Background(),
+		getApplicationSetListers(&config.Cluster{KubernetesClient: client}, applicationGVR),
+		newKubernetesBackend(client, "argocd"),
+		[]string{"argocd"},
+		validatedDeployment,
+	)
+	if err != nil {
+		t.Fatalf("getApplicationSets() error = '%v'", err)
+	}
+
+	if len(applicationSets) != 1 {
+		t.Fatalf("getApplicationSets() returned %d applicationsets, expected 1", len(applicationSets))
+	}
+
+	// Applications are matched by owner reference, not by labels.
+	if !slices.Equal(applicationSets[0].generatedApplications, []string{"core-demo-api-dev-aks"}) {
+		t.Errorf("getApplicationSets() generated applications = %v, expected [core-demo-api-dev-aks]", applicationSets[0].generatedApplications)
+	}
+
+	expectedConditions := []model.ApplicationSetCondition{
+		{Type: "ErrorOccurred", Reason: "ApplicationGenerationFromParamsError", Message: "cluster gke not found"},
+	}
+	if !slices.Equal(applicationSets[0].conditions, expectedConditions) {
+		t.Errorf("getApplicationSets() conditions = %+v, expected %+v", applicationSets[0].conditions, expectedConditions)
+	}
+
+	var notGeneratedErr *model.ApplicationNotGeneratedError
+	if err := getApplicationNotGeneratedError(applicationSets, validatedDeployment); !errors.As(err, &notGeneratedErr) ||
+		notGeneratedErr.ClusterType != "gke" {
+		t.Errorf("getApplicationNotGeneratedError() = '%v', expected application not generated for gke", err)
+	}
+
+	var applicationSetErr *model.ApplicationSetFailedError
+	if err := getApplicationSetError(applicationSets, []string{"core-demo-api-dev-aks"}); !errors.As(err, &applicationSetErr) {
+		t.Errorf("getApplicationSetError() = '%v', expected applicationset failure", err)
+	}
+
+	if err := getApplicationSetError(applicationSets, []string{"core-demo-api-dev-manual"}); err != nil {
+		t.Errorf("getApplicationSetError() = '%v', expected no error for an application the applicationset did not generate", err)
+	}
+}
+
+func TestGetApplicationSetError(t *testing.T) {
+	tests := []struct {
+		name        string
+		condition   model.ApplicationSetCondition
+		expectError bool
+	}{
+		{
+			name: "failed to generate parameters",
+			condition: model.ApplicationSetCondition{
+				Type:    "ErrorOccurred",
+				Reason:  "ApplicationGenerationFromParamsError",
+				Message: "cluster gke not found",
+			},
+			expectError: true,
+		},
+		{
+			name: "failed to update the application",
+			condition: model.ApplicationSetCondition{
+				Type:    "ResourcesUpToDate",
+				Reason:  "UpdateApplicationError",
+				Message: "failed to update application core-demo-api-dev-aks: the object has been modified",
+			},
+			expectError: true,
+		},
+		{
+			name: "failed to update an application with a longer name",
+			condition: model.ApplicationSetCondition{
+				Type:    "ResourcesUpToDate",
+				Reason:  "UpdateApplicationError",
+				Message: "failed to update application core-demo-api-dev-aks-canary: the object has been modified",
+			},
+		},
+		{
+			name: "applicationset being updated",
+			condition: model.ApplicationSetCondition{
+				Type:    "ResourcesUpToDate",
+				Reason:  "ApplicationSetModified",
+				Message: "applicationset has been modified",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applicationSets := []applicationSet{{
+				name:                  "core-demo-api",
+				generatedApplications: []string{"core-demo-api-dev-aks", "core-demo-api-dev-aks-canary"},
+				conditions:            []model.ApplicationSetCondition{tt.condition},
+			}}
+
+			err := getApplicationSetError(applicationSets, []string{"core-demo-api-dev-aks"})
+			if (err != nil) != tt.expectError {
+				t.Errorf("getApplicationSetError() = '%v', expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestWatchApplicationsLifecycleNotGenerated(t *testing.T) {
+	client := newFakeDynamicClient(
+		newApplicationSet("core-demo-api", "uid-1", nil),
+		newGeneratedApplication("core-demo-api-dev-aks", "aks", "uid-1"),
+	)
+
+	_, err := watchApplicationsLifecycle(
+		context.Background(),
+		client,
+		newKubernetesBackend(client, "argocd"),
+		nil,
+		getApplicationSetListers(&config.Cluster{KubernetesClient: client}, applicationGVR),
+		applicationGVR,
+		[]string{"argocd"},
+		&model.ValidatedDeployment{Deployment: &model.Deployment{
+			System:          "core",
+			ApplicationName: "demo-api",
+			Environment:     "dev",
+			ClusterType:     "gke",
+		}},
+		time.Second,
+		time.Second,
+		nil,
+	)
+
+	if problemType := model.GetProblemType(err); problemType != model.ProblemApplicationNotGenerated {
+		t.Errorf("watchApplicationsLifecycle() error = '%v', expected problem type %s", err, model.ProblemApplicationNotGenerated.URI)
+	}
+}
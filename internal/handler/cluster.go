@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type clusterResult struct {
+	cluster string
+	results []model.ApplicationResult
+	err     error
+}
+
+// Watches the deployment in every cluster whose Argo CD manages its cluster type, merging the results.
+func watchClustersLifecycle(
+	ctx context.Context,
+	config *config.Config,
+	gvr schema.GroupVersionResource,
+	validatedDeployment *model.ValidatedDeployment,
+	timeout time.Duration,
+	onUpdate func(model.ApplicationStatus),
+) ([]model.ApplicationResult, error) {
+	clusters := config.GetClusters(validatedDeployment.Deployment)
+	if len(clusters) == 0 {
+		return nil, &model.ValidationError{
+			Err: fmt.Errorf(
+				"no cluster manages cluster type %s in environment %s",
+				validatedDeployment.Deployment.ClusterType,
+				validatedDeployment.Deployment.Environment,
+			),
+		}
+	}
+
+	// Actions patch Argo CD applications through the Kubernetes API, which Flux clusters and remote Argo CD APIs do not provide.
+	// Logs are read from the cluster the application is deployed to instead, and are left out without access to it.
+	actions := slices.DeleteFunc(validatedDeployment.Deployment.Actions(), func(action string) bool {
+		return action == model.PolicyActionLogs
+	})
+	if len(actions) > 0 {
+		for _, cluster := range clusters {
+			if cluster.ArgoCDClient() == nil {
+				return nil, &model.ValidationError{
+					Err: fmt.Errorf("cluster %s does not support actions %s", cluster.Name, strings.Join(actions, ", ")),
+				}
+			}
+		}
+	}
+
+	// Rolling back happens after the deadline, so it is bounded separately to keep requests from running for twice the timeout.
+	rollbackTimeout := timeout
+	if config.RollbackTimeout > 0 {
+		rollbackTimeout = min(timeout, config.RollbackTimeout)
+	}
+
+	clusterResultCh := make(chan clusterResult, len(clusters))
+
+	for _, cluster := range clusters {
+		go func() {
+			var clusterOnUpdate func(model.ApplicationStatus)
+			if onUpdate != nil {
+				clusterOnUpdate = func(status model.ApplicationStatus) {
+					status.Cluster = cluster.Name
+					onUpdate(status)
+				}
+			}
+
+			results, err := watchApplicationsLifecycle(
+				ctx,
+				cluster.ArgoCDClient(),
+				getApplicationClients(config, cluster, gvr),
+				getWorkloadClients(cluster),
+				getApplicationSetListers(cluster, gvr),
+				gvr,
+				cluster.ApplicationNamespaces,
+				validatedDeployment,
+				timeout,
+				rollbackTimeout,
+				clusterOnUpdate,
+			)
+
+			for i := range results {
+				results[i].Cluster = cluster.Name
+			}
+
+			clusterResultCh <- clusterResult{cluster: cluster.Name, results: results, err: err}
+		}()
+	}
+
+	clusterResults := make([]clusterResult, 0, len(clusters))
+	for range clusters {
+		clusterResults = append(clusterResults, <-clusterResultCh)
+	}
+
+	results, err := mergeClusterResults(clusterResults)
+	limitDiagnostics(results)
+
+	return results, err
+}
+
+// Merges the results of several clusters. Clusters without matching applications are ignored if another cluster has them,
+// since not every Argo CD manages every application, and the applications still pending in any cluster are collected into a single error.
+func mergeClusterResults(clusterResults []clusterResult) ([]model.ApplicationResult, error) {
+	if len(clusterResults) == 1 {
+		return clusterResults[0].results, clusterResults[0].err
+	}
+
+	slices.SortFunc(clusterResults, func(a, b clusterResult) int {
+		return strings.Compare(a.cluster, b.cluster)
+	})
+
+	var (
+		results             []model.ApplicationResult
+		errs                []error
+		notFoundErr         error
+		pendingApplications []string
+		timeout             time.Duration
+	)
+
+	for _, clusterResult := range clusterResults {
+		results = append(results, clusterResult.results...)
+
+		if clusterResult.err == nil {
+			continue
+		}
+
+		if isApplicationNotFound(clusterResult.err) {
+			var notGeneratedErr *model.ApplicationNotGeneratedError
+			if notFoundErr == nil || errors.As(clusterResult.err, &notGeneratedErr) {
+				notFoundErr = clusterResult.err
+			}
+
+			continue
+		}
+
+		var deploymentTimeoutError *model.DeploymentTimeoutError
+		if errors.As(clusterResult.err, &deploymentTimeoutError) {
+			pendingApplications = append(pendingApplications, deploymentTimeoutError.PendingApplications...)
+			timeout = deploymentTimeoutError.Timeout
+
+			// Only the other errors of the cluster are reported here, the timeout is reported for all clusters below.
+			if clusterResult.err == error(deploymentTimeoutError) {
+				continue
+			}
+
+			errs = append(errs, fmt.Errorf("cluster %s: %v", clusterResult.cluster, clusterResult.err))
+
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("cluster %s: %w", clusterResult.cluster, clusterResult.err))
+	}
+
+	if len(results) == 0 && len(errs) == 0 && len(pendingApplications) == 0 {
+		return nil, notFoundErr
+	}
+
+	if len(pendingApplications) > 0 {
+		slices.Sort(pendingApplications)
+
+		errs = append(errs, &model.DeploymentTimeoutError{
+			Timeout:             timeout,
+			PendingApplications: pendingApplications,
+		})
+	}
+
+	slices.SortFunc(results, func(a, b model.ApplicationResult) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+
+	return results, chainErrors(errs)
+}
+
+func isApplicationNotFound(err error) bool {
+	var (
+		applicationNotFoundError *model.ApplicationNotFoundError
+		notGeneratedErr          *model.ApplicationNotGeneratedError
+	)
+
+	return errors.As(err, &applicationNotFoundError) || errors.As(err, &notGeneratedErr)
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWatchClustersLifecycle(t *testing.T) {
+	const image = "ghcr.io/3lvia/core-demo-api:dev@sha256:1234567890abcdef"
+
+	deployed := newGeneratedApplication("core-demo-api-dev-aks", "aks", "")
+	deployed.Object["status"] = map[string]any{
+		"sync":    map[string]any{"status": "Synced"},
+		"health":  map[string]any{"status": "Healthy"},
+		"summary": map[string]any{"images": []any{image}},
+	}
+
+	aksClient := newFakeDynamicClient(deployed)
+	aksClient.PrependWatchReactor("applications", func(k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewRaceFreeFake()
+		w.Add(deployed.DeepCopy())
+
+		return true, w, nil
+	})
+
+	conf := &config.Config{
+		Clusters: []*config.Cluster{
+			{
+				Name:                  "aks-management",
+				ClusterTypes:          []string{"aks"},
+				ApplicationNamespaces: []string{"argocd"},
+				KubernetesClient:      aksClient,
+			},
+			{
+				Name:                  "gke-management",
+				ClusterTypes:          []string{"gke"},
+				ApplicationNamespaces: []string{"argocd"},
+				KubernetesClient:      newFakeDynamicClient(),
+			},
+		},
+	}
+
+	newValidatedDeployment := func(clusterType string, checkAllClusters bool) *model.ValidatedDeployment {
+		return &model.ValidatedDeployment{Deployment: &model.Deployment{
+			System:           "core",
+			ApplicationName:  "demo-api",
+			Environment:      "dev",
+			ClusterType:      clusterType,
+			CheckAllClusters: checkAllClusters,
+			Image:            image,
+		}}
+	}
+
+	var updates []model.ApplicationStatus
+
+	// The gke cluster has no applications, which is fine as long as another cluster has them.
+	results, err := watchClustersLifecycle(
+		context.Background(),
+		conf,
+		applicationGVR,
+		newValidatedDeployment("aks", true),
+		5*time.Second,
+		func(status model.ApplicationStatus) {
+			updates = append(updates, status)
+		},
+	)
+	if err != nil {
+		t.Fatalf("watchClustersLifecycle() error = '%v'", err)
+	}
+
+	if len(results) != 1 || results[0].Cluster != "aks-management" || results[0].Outcome != model.ApplicationOutcomeDeployed {
+		t.Errorf("watchClustersLifecycle() = %+v, expected the application deployed in aks-management", results)
+	}
+
+	if len(updates) == 0 || updates[0].Cluster != "aks-management" {
+		t.Errorf("watchClustersLifecycle() updates = %+v, expected updates from aks-management", updates)
+	}
+
+	if _, err := watchClustersLifecycle(
+		context.Background(),
+		conf,
+		applicationGVR,
+		newValidatedDeployment("gke", false),
+		5*time.Second,
+		nil,
+	); model.GetProblemType(err) != model.ProblemApplicationNotFound {
+		t.Errorf("watchClustersLifecycle() error = '%v', expected application not found in gke-management", err)
+	}
+
+	if _, err := watchClustersLifecycle(
+		context.Background(),
+		conf,
+		applicationGVR,
+		newValidatedDeployment("openshift", false),
+		5*time.Second,
+		nil,
+	); model.GetProblemType(err) != model.ProblemValidationFailed {
+		t.Errorf("watchClustersLifecycle() error = '%v', expected no cluster to manage openshift", err)
+	}
+}
+
+func TestMergeClusterResults(t *testing.T) {
+	results, err := mergeClusterResults([]clusterResult{
+		{
+			cluster: "gke-management",
+			results: []model.ApplicationResult{{ApplicationStatus: model.ApplicationStatus{Name: "b", Cluster: "gke-management"}}},
+			err:     &model.DeploymentTimeoutError{Timeout: time.Minute, PendingApplications: []string{"b"}},
+		},
+		{
+			cluster: "aks-management",
+			results: []model.ApplicationResult{{ApplicationStatus: model.ApplicationStatus{Name: "a", Cluster: "aks-management"}}},
+			err:     &model.DeploymentTimeoutError{Timeout: time.Minute, PendingApplications: []string{"a"}},
+		},
+		{
+			cluster: "openshift-management",
+			err:     &model.ApplicationNotFoundError{},
+		},
+	})
+
+	if len(results) != 2 || results[0].Name != "a" || results[1].Name != "b" {
+		t.Errorf("mergeClusterResults() = %+v, expected results of both clusters sorted by cluster", results)
+	}
+
+	expected := "timed out after 1m0s waiting for application(s) a, b"
+	if err == nil || err.Error() != expected {
+		t.Errorf("mergeClusterResults() error = '%v', expected '%s'", err, expected)
+	}
+}
@@ -2,13 +2,16 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/3lvia/deployvia/internal/backend"
 	"github.com/3lvia/deployvia/internal/config"
 	"github.com/3lvia/deployvia/internal/model"
 	"github.com/gin-gonic/gin"
@@ -16,39 +19,28 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 )
 
+var (
+	errApplicationTimeout = errors.New("timed out waiting for application lifecycle")
+	errWatchClosed        = &model.WatchFailedError{Err: errors.New("watch closed unexpectedly")}
+)
+
 func PostDeployment(
 	ctx context.Context,
 	c *gin.Context,
 	config *config.Config,
 ) {
-	testingEnableOIDC := os.Getenv("TESTING_ENABLE_OIDC") == "true"
-	if testingEnableOIDC {
-		log.Errorf("TESTING_ENABLE_OIDC is set to true; THIS SHOULD NEVER BE USED IN PRODUCTION!")
+	identity, ok := authenticate(ctx, c, config)
+	if !ok {
+		return
 	}
 
-	if !config.Local || testingEnableOIDC {
-		gitHubOIDCToken := c.Request.Header.Get("X-GitHub-OIDC-Token")
-		if gitHubOIDCToken == "" {
-			err := fmt.Errorf("X-GitHub-OIDC-Token header is required")
-			log.Error(err)
-			c.JSON(400, gin.H{"error": err.Error()})
-
-			return
-		}
-
-		const GitHubOIDCURL = "https://token.actions.githubusercontent.com/.well-known/jwks"
-
-		_, err := model.ValidateToken(ctx, gitHubOIDCToken, GitHubOIDCURL)
-		if err != nil {
-			err := fmt.Errorf("invalid token: %w", err)
-			log.Error(err)
-			c.JSON(403, gin.H{"error": err.Error()})
-
-			return
-		}
+	// Only checked here and not when polling, since the same token is used to poll for the result.
+	if !checkReplay(ctx, c, config, identity) {
+		return
 	}
 
 	validatedDeployment, err := func() (*model.ValidatedDeployment, error) {
@@ -60,13 +52,17 @@ func PostDeployment(
 		return model.ValidateDeployment(&deployment)
 	}()
 	if err != nil {
-		err := fmt.Errorf("invalid deployment: %w", err)
+		err := &model.ValidationError{Err: fmt.Errorf("invalid deployment: %w", err)}
 		log.Error(err)
-		c.JSON(400, gin.H{"error": err.Error()})
+		writeProblem(c, err, nil)
 
 		return
 	}
 
+	if !authorize(c, config, identity, validatedDeployment.Deployment) {
+		return
+	}
+
 	timeout := func() time.Duration {
 		const defaultTimeout = 3 * time.Minute
 
@@ -83,100 +79,540 @@ func PostDeployment(
 		return timeout
 	}()
 
+	if config.MaxTimeout > 0 && timeout > config.MaxTimeout {
+		err := &model.ValidationError{
+			Err: fmt.Errorf("invalid X-Timeout: %s exceeds the maximum of %s", timeout, config.MaxTimeout),
+		}
+		log.Error(err)
+		writeProblem(c, err, nil)
+
+		return
+	}
+
 	gvr := schema.GroupVersionResource{
 		Group:    "argoproj.io",
 		Version:  "v1alpha1",
 		Resource: "applications",
 	}
 
-	err = watchApplicationsLifecycle(
-		ctx,
-		config.KubernetesClient,
+	if strings.Contains(c.Request.Header.Get("Accept"), "text/event-stream") {
+		streamDeployment(c.Request.Context(), c, config, gvr, validatedDeployment, timeout)
+
+		return
+	}
+
+	if c.Request.Header.Get("X-Async") == "true" {
+		job, err := config.Jobs.Create(validatedDeployment.Deployment)
+		if err != nil {
+			log.Error(err)
+			writeProblem(c, err, nil)
+
+			return
+		}
+
+		// Not bound to the request context, since the job outlives the request.
+		go func() {
+			applications, err := watchClustersLifecycle(
+				ctx,
+				config,
+				gvr,
+				validatedDeployment,
+				timeout,
+				func(status model.ApplicationStatus) {
+					config.Jobs.UpdateApplication(job.ID, status)
+				},
+			)
+			if err != nil {
+				log.Errorf("job %s failed: %v", job.ID, err)
+			}
+
+			config.Jobs.Finish(job.ID, model.NewDeploymentResult(applications, err))
+		}()
+
+		location := fmt.Sprintf("/deployment/%s", job.ID)
+		c.Header("Location", location)
+		c.JSON(202, gin.H{"id": job.ID, "status": job.Status, "location": location})
+
+		return
+	}
+
+	// Stop watching if the client goes away.
+	applications, err := watchClustersLifecycle(
+		c.Request.Context(),
+		config,
 		gvr,
-		"argocd",
 		validatedDeployment,
 		timeout,
+		nil,
 	)
 	if err != nil {
 		log.Error(err)
-		c.JSON(500, gin.H{"error": err.Error()})
+		writeProblem(c, err, model.NewDeploymentResult(applications, err))
 
 		return
 	}
 
-	c.JSON(200, gin.H{"message": "Application successfully deployed!"})
+	c.JSON(200, model.NewDeploymentResult(applications, nil))
+}
+
+// Streams every observed application event as a Server-Sent Event, ending with a 'result' event carrying the outcome.
+func streamDeployment(
+	ctx context.Context,
+	c *gin.Context,
+	config *config.Config,
+	gvr schema.GroupVersionResource,
+	validatedDeployment *model.ValidatedDeployment,
+	timeout time.Duration,
+) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		updates = make(chan model.ApplicationStatus)
+		done    = make(chan *model.DeploymentResult, 1)
+	)
+
+	go func() {
+		applications, err := watchClustersLifecycle(
+			ctx,
+			config,
+			gvr,
+			validatedDeployment,
+			timeout,
+			func(status model.ApplicationStatus) {
+				select {
+				case updates <- status:
+				case <-ctx.Done():
+				}
+			},
+		)
+		if err != nil {
+			log.Error(err)
+		}
+
+		done <- model.NewDeploymentResult(applications, err)
+	}()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case status := <-updates:
+			c.SSEvent("progress", status)
+
+			return true
+		case result := <-done:
+			c.SSEvent("result", result)
+
+			return false
+		}
+	})
 }
 
+func GetDeployment(
+	ctx context.Context,
+	c *gin.Context,
+	config *config.Config,
+) {
+	identity, ok := authenticate(ctx, c, config)
+	if !ok {
+		return
+	}
+
+	job, ok := config.Jobs.Get(c.Param("id"))
+	if !ok {
+		err := &model.DeploymentJobNotFoundError{ID: c.Param("id")}
+		log.Error(err)
+		writeProblem(c, err, nil)
+
+		return
+	}
+
+	if !authorize(c, config, identity, &job.Deployment) {
+		return
+	}
+
+	c.JSON(200, job)
+}
+
+// Authenticates the caller with the first identity provider whose token header is set,
+// writing an error response and returning false if it is not accepted.
+// The returned identity is nil when running locally without OIDC.
+func authenticate(
+	ctx context.Context,
+	c *gin.Context,
+	config *config.Config,
+) (*model.CallerIdentity, bool) {
+	testingEnableOIDC := os.Getenv("TESTING_ENABLE_OIDC") == "true"
+	if testingEnableOIDC {
+		log.Errorf("TESTING_ENABLE_OIDC is set to true; THIS SHOULD NEVER BE USED IN PRODUCTION!")
+	}
+
+	if config.Local && !testingEnableOIDC {
+		return nil, true
+	}
+
+	var tokenHeaders []string
+	for _, identityProvider := range config.IdentityProviders {
+		token := c.Request.Header.Get(identityProvider.TokenHeader())
+		if token == "" {
+			tokenHeaders = append(tokenHeaders, identityProvider.TokenHeader())
+			continue
+		}
+
+		identity, err := identityProvider.Authenticate(ctx, token)
+		if err != nil {
+			err := &model.TokenInvalidError{Err: err}
+			log.Error(err)
+			writeProblem(c, err, nil)
+
+			return nil, false
+		}
+
+		log.WithFields(log.Fields{
+			"provider":       identity.Provider,
+			"trustedIssuer":  identity.TrustedIssuer,
+			"repository":     identity.Repository,
+			"jobWorkflowRef": identity.JobWorkflowRef,
+			"ref":            identity.Ref,
+		}).Info("Authenticated caller")
+
+		return identity, true
+	}
+
+	err := &model.TokenMissingError{TokenHeaders: tokenHeaders}
+	log.Error(err)
+	writeProblem(c, err, nil)
+
+	return nil, false
+}
+
+// Checks that the token of the caller has not been used before, writing an error response and returning false if it is rejected.
+func checkReplay(
+	ctx context.Context,
+	c *gin.Context,
+	config *config.Config,
+	identity *model.CallerIdentity,
+) bool {
+	err := config.ReplayProtection.Check(ctx, identity)
+	if err == nil {
+		return true
+	}
+
+	var tokenInvalidError *model.TokenInvalidError
+	if !errors.As(err, &tokenInvalidError) {
+		err = &model.TokenInvalidError{Err: err}
+	}
+
+	log.Error(err)
+	writeProblem(c, err, nil)
+
+	return false
+}
+
+// Checks the caller against the authorization policy, writing an error response and returning false if it is denied.
+// Callers are not authorized when running locally without OIDC.
+func authorize(
+	c *gin.Context,
+	config *config.Config,
+	identity *model.CallerIdentity,
+	deployment *model.Deployment,
+) bool {
+	if identity == nil {
+		return true
+	}
+
+	if err := config.Policy.Authorize(identity, deployment); err != nil {
+		log.Error(err)
+		writeProblem(c, err, nil)
+
+		return false
+	}
+
+	return true
+}
+
+// Writes the error as RFC 7807 problem details, extended with the result of the deployment if it was watched.
+func writeProblem(c *gin.Context, err error, result *model.DeploymentResult) {
+	problem := model.NewProblem(err, c.Request.URL.Path, result)
+
+	c.Header("Content-Type", model.ProblemContentType)
+	c.JSON(problem.Status, problem)
+}
+
+// Returns the shared informer cache if it covers the namespace, and otherwise the API server, or the Kustomizations and HelmReleases for Flux.
+// Watches are resumed when they are closed, until the caller stops them.
+func getApplicationClient(
+	config *config.Config,
+	cluster *config.Cluster,
+	gvr schema.GroupVersionResource,
+	namespace string,
+) backend.StatusBackend {
+	if cluster.IsFlux() {
+		return withWatchRetry(config, backend.NewFlux(cluster.KubernetesClient, namespace), namespace)
+	}
+
+	var applicationLister backend.ApplicationLister = cluster.KubernetesClient.Resource(gvr).Namespace(namespace)
+	if applicationInformer, ok := cluster.ApplicationInformers[namespace]; ok {
+		applicationLister = applicationInformer
+	}
+
+	return withWatchRetry(config, backend.NewKubernetes(applicationLister), namespace)
+}
+
+// Resumes watches of the backend when they are closed, recording every reconnect for the namespace.
+func withWatchRetry(config *config.Config, statusBackend backend.StatusBackend, namespace string) backend.StatusBackend {
+	return &retryApplicationClient{
+		StatusBackend: statusBackend,
+		backoff:       defaultWatchBackoff,
+		onReconnect: func(ctx context.Context) {
+			config.ApplicationMetrics.RecordWatchReconnect(ctx, namespace)
+		},
+	}
+}
+
+// Watches all applications matching the deployment until they are deployed, or until the timeout has passed.
+// The timeout covers listing, triggering and watching the applications, while rolling them back is bounded by 'rollbackTimeout'.
+// Returns the result of every watched application, sorted by name, along with the combined error.
 func watchApplicationsLifecycle(
 	ctx context.Context,
 	client dynamic.Interface,
+	applicationClient backend.StatusBackend,
+	workloadClients workloadClients,
+	applicationSetListers applicationSetListers,
 	gvr schema.GroupVersionResource,
-	namespace string,
+	namespaces []string,
 	validatedDeployment *model.ValidatedDeployment,
 	timeout time.Duration,
-) error {
-	applications, err := client.Resource(gvr).Namespace(namespace).List(
-		ctx,
+	rollbackTimeout time.Duration,
+	onUpdate func(model.ApplicationStatus),
+) ([]model.ApplicationResult, error) {
+	watchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	applications, err := applicationClient.List(
+		watchCtx,
 		metav1.ListOptions{
 			LabelSelector: getLabelSelector(validatedDeployment),
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to get application for deployment: %w", err)
+		return nil, &model.WatchFailedError{Err: fmt.Errorf("failed to get application for deployment: %w", err)}
+	}
+
+	// ApplicationSets are optional, so failing to read them only means that their errors are not reported.
+	applicationSets, err := getApplicationSets(watchCtx, applicationSetListers, applicationClient, namespaces, validatedDeployment)
+	if err != nil {
+		log.Warnf("Not checking applicationsets: %v", err)
 	}
 
 	if len(applications.Items) == 0 {
-		return fmt.Errorf("application(s) not found")
+		if err := getApplicationNotGeneratedError(applicationSets, validatedDeployment); err != nil {
+			return nil, err
+		}
+
+		return nil, &model.ApplicationNotFoundError{LabelSelector: getLabelSelector(validatedDeployment)}
 	}
 
 	if len(applications.Items) > 1 && !validatedDeployment.Deployment.CheckAllClusters {
-		return fmt.Errorf("multiple applications found when only one was expected")
+		names := make([]string, 0, len(applications.Items))
+		for _, application := range applications.Items {
+			names = append(names, application.GetName())
+		}
+
+		return nil, &model.AmbiguousApplicationError{Applications: names}
 	}
 
-	var applicationNames []string
+	var (
+		applicationRefs  []applicationRef
+		applicationNames []string
+	)
 	for _, application := range applications.Items {
 		name, found, err := unstructured.NestedString(application.Object, "metadata", "name")
 		if err != nil {
-			return fmt.Errorf("failed to get application name: %w", err)
+			return nil, fmt.Errorf("failed to get application name: %w", err)
+		}
+
+		if !found {
+			continue
+		}
+
+		if validatedDeployment.Deployment.RollbackOnFailure &&
+			isHealthyBeforeDeployment(&application, validatedDeployment.Deployment.Image) {
+			if err := recordHealthyHistoryEntry(watchCtx, client, gvr, &application); err != nil {
+				log.Warnf("Failed to record the healthy revision of %s: %v", name, err)
+			}
 		}
 
-		if found {
-			applicationNames = append(applicationNames, name)
+		if err := triggerApplication(
+			watchCtx,
+			client,
+			gvr,
+			application.GetNamespace(),
+			&application,
+			validatedDeployment.Deployment,
+		); err != nil {
+			return nil, fmt.Errorf("failed to trigger %s: %w", name, err)
 		}
+
+		applicationRefs = append(applicationRefs, applicationRef{namespace: application.GetNamespace(), name: name})
+		applicationNames = append(applicationNames, name)
 	}
 
 	var (
-		wg    sync.WaitGroup
-		errCh = make(chan error, len(applicationNames)) // buffered to avoid goroutine leaks
+		wg       sync.WaitGroup
+		resultCh = make(chan model.ApplicationResult, len(applicationRefs)) // buffered to avoid goroutine leaks
+		errCh    = make(chan applicationError, len(applicationRefs))
 	)
 
-	for _, applicationName := range applicationNames {
+	for _, ref := range applicationRefs {
 		wg.Add(1)
-		appName := applicationName // avoid loop variable capture issue
+		appName, appNamespace := ref.name, ref.namespace // avoid loop variable capture issue
 
 		go func() {
 			defer wg.Done()
-			err := watchApplicationLifecycle(
-				ctx,
-				client,
-				gvr,
-				namespace,
+
+			start := time.Now()
+
+			// The last observed status is reported in the result; updates are sent sequentially, first while watching and then while rolling back.
+			lastStatus := model.ApplicationStatus{Name: appName, Namespace: appNamespace}
+			update := func(status model.ApplicationStatus) {
+				lastStatus = status
+
+				if onUpdate != nil {
+					onUpdate(status)
+				}
+			}
+
+			application, err := watchApplicationLifecycle(
+				watchCtx,
+				applicationClient,
+				workloadClients,
 				validatedDeployment,
-				timeout,
+				appNamespace,
 				appName,
+				update,
 			)
+
+			// Collected before rolling back, since the rollback replaces the failing resources.
+			var diagnostics *model.Diagnostics
+			if err != nil && application != nil && !errors.Is(err, context.Canceled) {
+				diagnostics = collectDiagnostics(
+					ctx,
+					applicationClient,
+					workloadClients,
+					application,
+					validatedDeployment.Deployment.IncludeLogs,
+				)
+			}
+
+			if validatedDeployment.Deployment.RollbackOnFailure {
+				switch {
+				case err == nil && application != nil:
+					if err := recordHealthyHistoryEntry(ctx, client, gvr, application); err != nil {
+						log.Warnf("Failed to record the healthy revision of %s: %v", appName, err)
+					}
+				case shouldRollback(err):
+					err = rollbackApplication(
+						ctx,
+						client,
+						applicationClient,
+						gvr,
+						appNamespace,
+						appName,
+						rollbackTimeout,
+						err,
+						update,
+					)
+				}
+			}
+
+			result := model.NewApplicationResult(lastStatus, getApplicationOutcome(err), err, time.Since(start))
+			result.Diagnostics = diagnostics
+
+			resultCh <- result
+
 			if err != nil {
-				errCh <- fmt.Errorf("failed to watch %s: %w", appName, err)
+				errCh <- applicationError{applicationName: appName, err: err}
 			}
 		}()
 	}
 
 	wg.Wait()
+	close(resultCh)
 	close(errCh)
 
-	// Check if any errors occurred
+	var results []model.ApplicationResult
+	for result := range resultCh {
+		results = append(results, result)
+	}
+
+	slices.SortFunc(results, func(a, b model.ApplicationResult) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Namespace, b.Namespace)
+	})
+
+	err = combineApplicationErrors(errCh, timeout)
+
+	// Errors of the applications are wrapped, so that they decide the problem type.
+	if applicationSetErr := getApplicationSetError(applicationSets, applicationNames); applicationSetErr != nil {
+		if err == nil {
+			err = applicationSetErr
+		} else {
+			err = fmt.Errorf("%w; %v", err, applicationSetErr)
+		}
+	}
+
+	return results, err
+}
+
+type applicationError struct {
+	applicationName string
+	err             error
+}
+
+// Combines the errors of all applications, collecting the applications that timed out into a single error.
+func combineApplicationErrors(errCh <-chan applicationError, timeout time.Duration) error {
+	var (
+		errs                []error
+		pendingApplications []string
+	)
+
+	for applicationErr := range errCh {
+		if errors.Is(applicationErr.err, errApplicationTimeout) {
+			pendingApplications = append(pendingApplications, applicationErr.applicationName)
+
+			// Only the outcome of a rollback is worth reporting for a pending application.
+			if applicationErr.err == errApplicationTimeout {
+				continue
+			}
+		}
+
+		errs = append(errs, fmt.Errorf("failed to watch %s: %w", applicationErr.applicationName, applicationErr.err))
+	}
+
+	if len(pendingApplications) > 0 {
+		slices.Sort(pendingApplications)
+
+		errs = append(errs, &model.DeploymentTimeoutError{
+			Timeout:             timeout,
+			PendingApplications: pendingApplications,
+		})
+	}
+
+	return chainErrors(errs)
+}
+
+// Combines the errors into one, wrapping only the last error so that it decides the problem type.
+func chainErrors(errs []error) error {
 	var combinedErr error
-	for err := range errCh {
+	for _, err := range errs {
 		if combinedErr == nil {
 			combinedErr = err
 		} else {
@@ -184,113 +620,315 @@ func watchApplicationsLifecycle(
 		}
 	}
 
-	if combinedErr != nil {
-		return combinedErr
-	}
+	return combinedErr
+}
 
-	return nil
+func getApplicationOutcome(err error) string {
+	switch {
+	case err == nil:
+		return model.ApplicationOutcomeDeployed
+	case errors.Is(err, errApplicationTimeout):
+		return model.ApplicationOutcomeTimedOut
+	case errors.Is(err, context.Canceled):
+		return model.ApplicationOutcomeCancelled
+	default:
+		return model.ApplicationOutcomeFailed
+	}
 }
 
+// Watches the application until it is deployed or fails, returning the last observed application for diagnostics.
 func watchApplicationLifecycle(
 	ctx context.Context,
-	client dynamic.Interface,
-	gvr schema.GroupVersionResource,
-	namespace string,
+	applicationClient backend.StatusBackend,
+	workloadClients workloadClients,
 	validatedDeployment *model.ValidatedDeployment,
-	timeout time.Duration,
+	namespace string,
 	applicationName string,
-) error {
-	w, err := client.Resource(gvr).Namespace(namespace).Watch(
+	onUpdate func(model.ApplicationStatus),
+) (*unstructured.Unstructured, error) {
+	w, err := applicationClient.Watch(
 		ctx,
 		metav1.ListOptions{
-			FieldSelector:  fmt.Sprintf("metadata.name=%s", applicationName),
-			TimeoutSeconds: int64Ptr(int64(timeout.Seconds())),
+			FieldSelector: getApplicationFieldSelector(namespace, applicationName),
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to watch application: %w", err)
+		return nil, &model.WatchFailedError{Err: fmt.Errorf("failed to watch application: %w", err)}
 	}
 
 	defer w.Stop()
 
 	resultChan := w.ResultChan()
 
+	var (
+		// The last application is checked again on 'recheck' while its workloads are rolling out.
+		lastObj *unstructured.Unstructured
+		recheck <-chan time.Time
+		// The pod hashes of the rollouts when they were first seen, to tell a new revision from the previous one.
+		initialPodHashes = map[string]string{}
+	)
+
 	for {
+		var (
+			obj     *unstructured.Unstructured
+			evtType watch.EventType
+		)
+
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			// The watch is resumed when the API server closes it, so the deadline is only enforced here.
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return lastObj, errApplicationTimeout
+			}
+
+			return lastObj, ctx.Err()
+		case <-recheck:
+			obj, evtType = lastObj, "RECHECK"
 		case evt, ok := <-resultChan:
 			if !ok {
-				return fmt.Errorf("watch closed unexpectedly")
+				return lastObj, errWatchClosed
 			}
 
-			obj, ok := evt.Object.(*unstructured.Unstructured)
+			obj, ok = evt.Object.(*unstructured.Unstructured)
 			if !ok {
 				continue
 			}
 
-			system, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/system")
-			if err != nil || !found {
-				return fmt.Errorf("failed to get system label: %w", err)
-			}
+			evtType = evt.Type
+		}
 
-			name, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/application")
-			if err != nil || !found {
-				return fmt.Errorf("failed to get application label: %w", err)
-			}
+		recheck = nil
+		lastObj = obj
 
-			environment, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "kubernetes.io/environment")
-			if err != nil || !found {
-				return fmt.Errorf("failed to get environment label: %w", err)
-			}
+		system, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/system")
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get system label: %w", err)
+		}
 
-			clusterType, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/cluster-type")
-			if err != nil || !found {
-				return fmt.Errorf("failed to get cluster-type label: %w", err)
-			}
+		name, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/application")
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get application label: %w", err)
+		}
+
+		environment, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "kubernetes.io/environment")
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get environment label: %w", err)
+		}
+
+		clusterType, found, err := unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/cluster-type")
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get cluster-type label: %w", err)
+		}
+
+		syncStatus, found, err := unstructured.NestedString(obj.Object, "status", "sync", "status")
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get sync status: %w", err)
+		}
+
+		healthStatus, found, err := unstructured.NestedString(obj.Object, "status", "health", "status")
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get health status: %w", err)
+		}
+
+		currentImages, found, err := unstructured.NestedStringSlice(
+			obj.Object,
+			"status",
+			"summary",
+			"images",
+		)
+		if err != nil || !found {
+			return lastObj, fmt.Errorf("failed to get current images: %w", err)
+		}
+
+		log_ := log.WithFields(log.Fields{
+			"system":      system,
+			"name":        name,
+			"environment": environment,
+			"clusterType": clusterType,
+		})
+
+		log_.Infof("Event: %s, sync=%s, health=%s\n", evtType, syncStatus, healthStatus)
+		log_.Infof("Current image(s): %v", strings.Join(currentImages, ", "))
+
+		synced := syncStatus == "Synced"
+		healthy := healthStatus == "Healthy"
+		imageDeployed := slices.Contains(currentImages, validatedDeployment.Deployment.Image)
 
-			syncStatus, found, err := unstructured.NestedString(obj.Object, "status", "sync", "status")
-			if err != nil || !found {
-				return fmt.Errorf("failed to get sync status: %w", err)
+		revision, _, _ := unstructured.NestedString(obj.Object, "status", "sync", "revision")
+
+		deployed := synced && healthy && imageDeployed
+
+		rollouts := getRollouts(ctx, workloadClients, obj, validatedDeployment.Deployment.Image)
+		for _, rollout := range rollouts {
+			log_.Infof("Rollout: %s", rollout)
+		}
+
+		recordInitialPodHashes(initialPodHashes, rollouts)
+
+		// Argo CD reports paused rollouts as suspended, and only healthy once they are fully promoted.
+		rolloutPaused := validatedDeployment.Deployment.AcceptPausedRollout &&
+			synced && imageDeployed && healthStatus == "Suspended" && rolloutsPaused(rollouts)
+
+		var workloads []model.WorkloadStatus
+		if deployed && validatedDeployment.Deployment.VerifyWorkloads {
+			workloads, err = verifyWorkloads(ctx, workloadClients, obj, validatedDeployment.Deployment.Image)
+			if err != nil {
+				log_.Errorf("Failed to verify workloads: %v", err)
+				return lastObj, err
 			}
 
-			healthStatus, found, err := unstructured.NestedString(obj.Object, "status", "health", "status")
-			if err != nil || !found {
-				return fmt.Errorf("failed to get health status: %w", err)
+			deployed = workloadsVerified(workloads)
+		}
+
+		deployed = deployed || rolloutPaused
+
+		if onUpdate != nil {
+			onUpdate(model.ApplicationStatus{
+				Name:         applicationName,
+				Namespace:    namespace,
+				ClusterType:  clusterType,
+				SyncStatus:   syncStatus,
+				HealthStatus: healthStatus,
+				Images:       currentImages,
+				Revision:     revision,
+				Deployed:     deployed,
+				Workloads:    workloads,
+				Rollouts:     rollouts,
+			})
+		}
+
+		if rolloutPaused {
+			log_.Info("Application is synced with the expected image, and its rollouts are paused")
+			return lastObj, nil
+		}
+
+		if deployed {
+			log_.Info("Application is synced and healthy with the expected image")
+			return lastObj, nil
+		}
+
+		if workloads != nil {
+			log_.Infof("Waiting for workloads to roll out: %v", workloads)
+			recheck = time.After(workloadRecheckInterval)
+
+			continue
+		}
+
+		if err := getRolloutFailure(rollouts, imageDeployed, initialPodHashes); err != nil {
+			err.Resources = getFailingResources(obj)
+
+			log_.Errorf("Rollout failed: %v", err)
+			return lastObj, err
+		}
+
+		if err := getApplicationFailure(obj, healthStatus, imageDeployed); err != nil {
+			if err.Reason == model.FailureReasonDegraded {
+				err.Resources = addDegradedTreeResources(ctx, applicationClient, namespace, applicationName, err.Resources)
 			}
 
-			currentImages, found, err := unstructured.NestedStringSlice(
+			log_.Errorf("Application failed: %v", err)
+			return lastObj, err
+		}
+
+		// Steps and analysis runs progress without changes to the application.
+		if len(rollouts) > 0 {
+			recheck = time.After(workloadRecheckInterval)
+		}
+	}
+}
+
+// Returns an error if Argo CD reports that the application can not become healthy for the target revision.
+// A degraded application is only considered failed once the expected image is in place,
+// since the previous revision being degraded should not fail the deployment of a fix.
+func getApplicationFailure(
+	obj *unstructured.Unstructured,
+	healthStatus string,
+	imageDeployed bool,
+) *model.ApplicationFailedError {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "phase")
+	if phase == "Failed" || phase == "Error" {
+		targetRevision, _, _ := unstructured.NestedString(obj.Object, "status", "sync", "revision")
+		operationRevision, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "syncResult", "revision")
+		if operationRevision == "" {
+			operationRevision, _, _ = unstructured.NestedString(
 				obj.Object,
 				"status",
-				"summary",
-				"images",
+				"operationState",
+				"operation",
+				"sync",
+				"revision",
 			)
-			if err != nil || !found {
-				return fmt.Errorf("failed to get current images: %w", err)
+		}
+
+		if targetRevision == "" || operationRevision == "" || targetRevision == operationRevision {
+			message, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "message")
+
+			return &model.ApplicationFailedError{
+				Reason:    model.FailureReasonSyncFailed,
+				Message:   message,
+				Resources: getFailingResources(obj),
 			}
+		}
+	}
 
-			log_ := log.WithFields(log.Fields{
-				"system":      system,
-				"name":        name,
-				"environment": environment,
-				"clusterType": clusterType,
-			})
+	if healthStatus == "Degraded" && imageDeployed {
+		message, _, _ := unstructured.NestedString(obj.Object, "status", "health", "message")
+
+		return &model.ApplicationFailedError{
+			Reason:    model.FailureReasonDegraded,
+			Message:   message,
+			Resources: getFailingResources(obj),
+		}
+	}
+
+	return nil
+}
 
-			log_.Infof("Event: %s, sync=%s, health=%s\n", evt.Type, syncStatus, healthStatus)
-			log_.Infof("Current image(s): %v", strings.Join(currentImages, ", "))
+// Returns the resources in 'status.resources' that are degraded, missing or out of sync.
+func getFailingResources(obj *unstructured.Unstructured) []model.ResourceStatus {
+	var failingResources []model.ResourceStatus
+	for _, resourceStatus := range backend.GetApplicationResources(obj) {
+		if resourceStatus.HealthStatus == "Degraded" ||
+			resourceStatus.HealthStatus == "Missing" ||
+			resourceStatus.SyncStatus == "OutOfSync" {
+			failingResources = append(failingResources, resourceStatus)
+		}
+	}
 
-			synced := syncStatus == "Synced"
-			healthy := healthStatus == "Healthy"
-			imageDeployed := slices.Contains(currentImages, validatedDeployment.Deployment.Image)
+	return failingResources
+}
 
-			if synced && healthy && imageDeployed {
-				log_.Info("Application is synced and healthy with the expected image")
-				return nil
-			}
-		case <-time.After(timeout):
-			return fmt.Errorf("timed out waiting for application lifecycle")
+// Adds the degraded resources of the resource tree that are not managed directly by the application, e.g. pods,
+// since those usually explain why a managed resource is degraded. The tree is best effort, as not every backend has it.
+func addDegradedTreeResources(
+	ctx context.Context,
+	applicationClient backend.StatusBackend,
+	namespace string,
+	applicationName string,
+	failingResources []model.ResourceStatus,
+) []model.ResourceStatus {
+	resourceTree, err := applicationClient.GetResourceTree(ctx, namespace, applicationName)
+	if err != nil {
+		log.Warnf("Failed to get resource tree of application %s: %v", applicationName, err)
+
+		return failingResources
+	}
+
+	for _, resource := range resourceTree {
+		if resource.HealthStatus != "Degraded" {
+			continue
+		}
+
+		if slices.ContainsFunc(failingResources, func(r model.ResourceStatus) bool {
+			return r.Group == resource.Group && r.Kind == resource.Kind && r.Namespace == resource.Namespace && r.Name == resource.Name
+		}) {
+			continue
 		}
+
+		failingResources = append(failingResources, resource)
 	}
+
+	return failingResources
 }
 
 func getLabelSelector(
@@ -313,7 +951,3 @@ func getLabelSelector(
 
 	return baseLabelSelector
 }
-
-func int64Ptr(i int64) *int64 {
-	return &i
-}
@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGetApplicationFailure(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         map[string]any
+		imageDeployed  bool
+		expectedReason string
+	}{
+		{
+			name: "healthy",
+			status: map[string]any{
+				"health": map[string]any{"status": "Healthy"},
+				"sync":   map[string]any{"status": "Synced", "revision": "abc"},
+			},
+			imageDeployed: true,
+		},
+		{
+			name: "degraded with expected image",
+			status: map[string]any{
+				"health": map[string]any{"status": "Degraded"},
+				"sync":   map[string]any{"status": "Synced", "revision": "abc"},
+				"resources": []any{
+					map[string]any{
+						"kind":      "Deployment",
+						"namespace": "core",
+						"name":      "demo-api",
+						"status":    "Synced",
+						"health":    map[string]any{"status": "Degraded", "message": "progress deadline exceeded"},
+					},
+					map[string]any{
+						"kind":      "Service",
+						"namespace": "core",
+						"name":      "demo-api",
+						"status":    "Synced",
+						"health":    map[string]any{"status": "Healthy"},
+					},
+				},
+			},
+			imageDeployed:  true,
+			expectedReason: model.FailureReasonDegraded,
+		},
+		{
+			name: "degraded without expected image",
+			status: map[string]any{
+				"health": map[string]any{"status": "Degraded"},
+				"sync":   map[string]any{"status": "OutOfSync", "revision": "abc"},
+			},
+			imageDeployed: false,
+		},
+		{
+			name: "sync failed for target revision",
+			status: map[string]any{
+				"health": map[string]any{"status": "Progressing"},
+				"sync":   map[string]any{"status": "OutOfSync", "revision": "abc"},
+				"operationState": map[string]any{
+					"phase":      "Failed",
+					"message":    "one or more objects failed to apply",
+					"syncResult": map[string]any{"revision": "abc"},
+				},
+			},
+			expectedReason: model.FailureReasonSyncFailed,
+		},
+		{
+			name: "sync failed for previous revision",
+			status: map[string]any{
+				"health": map[string]any{"status": "Healthy"},
+				"sync":   map[string]any{"status": "OutOfSync", "revision": "def"},
+				"operationState": map[string]any{
+					"phase":      "Error",
+					"syncResult": map[string]any{"revision": "abc"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]any{"status": tt.status}}
+			healthStatus, _, _ := unstructured.NestedString(obj.Object, "status", "health", "status")
+
+			err := getApplicationFailure(obj, healthStatus, tt.imageDeployed)
+			if tt.expectedReason == "" {
+				if err != nil {
+					t.Errorf("getApplicationFailure() error = '%v', expected no error", err)
+				}
+
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("getApplicationFailure() returned no error, expected reason %s", tt.expectedReason)
+			}
+
+			if err.Reason != tt.expectedReason {
+				t.Errorf("getApplicationFailure() reason = %s, expected %s", err.Reason, tt.expectedReason)
+			}
+
+			if tt.expectedReason == model.FailureReasonDegraded && len(err.Resources) != 1 {
+				t.Errorf("getApplicationFailure() returned %d failing resources, expected 1", len(err.Resources))
+			}
+		})
+	}
+}
+
+func TestWatchApplicationsLifecycleDeadline(t *testing.T) {
+	const image = "ghcr.io/3lvia/core-demo-api:dev@sha256:1234567890abcdef"
+
+	newLabeledApplication := func(name string, clusterType string, healthStatus string, images []any) *unstructured.Unstructured {
+		application := newApplication(name, nil)
+		application.SetLabels(map[string]string{
+			"elvia.no/system":           "core",
+			"elvia.no/application":      "demo-api",
+			"kubernetes.io/environment": "dev",
+			"elvia.no/cluster-type":     clusterType,
+		})
+		application.Object["status"] = map[string]any{
+			"sync":    map[string]any{"status": "Synced"},
+			"health":  map[string]any{"status": healthStatus},
+			"summary": map[string]any{"images": images},
+		}
+
+		return application
+	}
+
+	deployed := newLabeledApplication("core-demo-api-dev-aks", "aks", "Healthy", []any{image})
+	pending := newLabeledApplication("core-demo-api-dev-gke", "gke", "Progressing", []any{"old-image"})
+
+	client := newFakeDynamicClient(deployed, pending)
+	client.PrependWatchReactor("applications", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewRaceFreeFake()
+
+		name, _ := action.(k8stesting.WatchAction).GetWatchRestrictions().Fields.RequiresExactMatch("metadata.name")
+		if name == deployed.GetName() {
+			w.Add(deployed.DeepCopy())
+
+			return true, w, nil
+		}
+
+		// A chatty application that never becomes healthy must not be watched past the deadline.
+		go func() {
+			for range 50 {
+				w.Modify(pending.DeepCopy())
+				time.Sleep(50 * time.Millisecond)
+			}
+		}()
+
+		return true, w, nil
+	})
+
+	start := time.Now()
+
+	results, err := watchApplicationsLifecycle(
+		context.Background(),
+		client,
+		newKubernetesBackend(client, "argocd"),
+		nil,
+		nil,
+		applicationGVR,
+		[]string{"argocd"},
+		&model.ValidatedDeployment{Deployment: &model.Deployment{
+			ApplicationName:  "demo-api",
+			System:           "core",
+			Environment:      "dev",
+			CheckAllClusters: true,
+			Image:            image,
+		}},
+		500*time.Millisecond,
+		500*time.Millisecond,
+		nil,
+	)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("watchApplicationsLifecycle() returned after %s, expected the deadline to be enforced", elapsed)
+	}
+
+	var deploymentTimeoutError *model.DeploymentTimeoutError
+	if !errors.As(err, &deploymentTimeoutError) {
+		t.Fatalf("watchApplicationsLifecycle() error = '%v', expected DeploymentTimeoutError", err)
+	}
+
+	if !slices.Equal(deploymentTimeoutError.PendingApplications, []string{pending.GetName()}) {
+		t.Errorf(
+			"watchApplicationsLifecycle() pending applications = %v, expected [%s]",
+			deploymentTimeoutError.PendingApplications,
+			pending.GetName(),
+		)
+	}
+
+	expectedOutcomes := []string{model.ApplicationOutcomeDeployed, model.ApplicationOutcomeTimedOut}
+	if len(results) != len(expectedOutcomes) {
+		t.Fatalf("watchApplicationsLifecycle() returned %d results, expected %d", len(results), len(expectedOutcomes))
+	}
+
+	for i, expectedOutcome := range expectedOutcomes {
+		if results[i].Outcome != expectedOutcome {
+			t.Errorf("watchApplicationsLifecycle() %s outcome = %s, expected %s", results[i].Name, results[i].Outcome, expectedOutcome)
+		}
+	}
+
+	if results[1].HealthStatus != "Progressing" || results[1].ClusterType != "gke" {
+		t.Errorf("watchApplicationsLifecycle() did not report the last observed status of %s: %+v", results[1].Name, results[1])
+	}
+	if results[0].Diagnostics != nil || results[1].Diagnostics == nil {
+		t.Errorf("watchApplicationsLifecycle() did not collect diagnostics of only the pending application %s", results[1].Name)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -31,6 +32,29 @@ func SetupTestEnvironment(t *testing.T) *gin.Engine {
 	return router
 }
 
+// Checks that the response is a problem details document of the expected type.
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, expectedType model.ProblemType) {
+	t.Helper()
+
+	if status := rr.Code; status != expectedType.Status {
+		t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedType.Status)
+	}
+
+	contentType := rr.Header().Get("Content-Type")
+	if contentType != model.ProblemContentType {
+		t.Errorf("Handler returned wrong content type: got %v want %v", contentType, model.ProblemContentType)
+	}
+
+	var problem model.Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to unmarshal problem: %v", err)
+	}
+
+	if problem.Type != expectedType.URI || problem.Status != expectedType.Status {
+		t.Errorf("Handler returned wrong problem: got %v (%d) want %v (%d)", problem.Type, problem.Status, expectedType.URI, expectedType.Status)
+	}
+}
+
 func TestPostDeploymentNoBody(t *testing.T) {
 	router := SetupTestEnvironment(t)
 
@@ -43,26 +67,42 @@ func TestPostDeploymentNoBody(t *testing.T) {
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	expectedStatus := http.StatusBadRequest
-	if status := rr.Code; status != expectedStatus {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+	assertProblem(t, rr, model.ProblemValidationFailed)
+}
+
+func TestPostDeployment(t *testing.T) {
+	router := SetupTestEnvironment(t)
+
+	deployment := &model.Deployment{
+		ApplicationName: "demo-api-go",
+		System:          "core",
+		ClusterType:     "aks",
+		Environment:     "dev",
+		Image:           "ghcr.io/3lvia/core-demo-api-go:dev@sha256:1234567890abcdef",
 	}
 
-	expected := `{"error":"invalid deployment: invalid request"}`
-	if rr.Body.String() != expected {
-		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	body, err := json.Marshal(deployment)
+	if err != nil {
+		t.Fatalf("Failed to marshal deployment: %v", err)
 	}
 
-	contentType := rr.Header().Get("Content-Type")
-	expectedContentType := "application/json; charset=utf-8"
-	if contentType != expectedContentType {
-		t.Errorf("Handler returned wrong content type: got %v want %v", contentType, expectedContentType)
+	// Create a new HTTP request to the /deployment endpoint
+	req, err := http.NewRequest("POST", "/deployment", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
 	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, model.ProblemApplicationNotFound)
 }
 
-func TestPostDeployment(t *testing.T) {
+func TestPostDeploymentNoToken(t *testing.T) {
 	router := SetupTestEnvironment(t)
 
+	t.Setenv("TESTING_ENABLE_OIDC", "true")
+
 	deployment := &model.Deployment{
 		ApplicationName: "demo-api-go",
 		System:          "core",
@@ -85,28 +125,44 @@ func TestPostDeployment(t *testing.T) {
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	expectedStatus := http.StatusInternalServerError
-	if status := rr.Code; status != expectedStatus {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+	assertProblem(t, rr, model.ProblemTokenMissing)
+}
+
+func TestPostDeploymentInvalidToken(t *testing.T) {
+	router := SetupTestEnvironment(t)
+
+	t.Setenv("TESTING_ENABLE_OIDC", "true")
+
+	deployment := &model.Deployment{
+		ApplicationName: "demo-api-go",
+		System:          "core",
+		ClusterType:     "aks",
+		Environment:     "dev",
+		Image:           "ghcr.io/3lvia/core-demo-api-go@sha256:1234567890abcdef",
 	}
 
-	expected := `{"error":"application(s) not found"}`
-	if rr.Body.String() != expected {
-		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	body, err := json.Marshal(deployment)
+	if err != nil {
+		t.Fatalf("Failed to marshal deployment: %v", err)
 	}
 
-	contentType := rr.Header().Get("Content-Type")
-	expectedContentType := "application/json; charset=utf-8"
-	if contentType != expectedContentType {
-		t.Errorf("Handler returned wrong content type: got %v want %v", contentType, expectedContentType)
+	// Create a new HTTP request to the /deployment endpoint
+	req, err := http.NewRequest("POST", "/deployment", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
 	}
+
+	req.Header.Add("X-GitHub-OIDC-Token", "invalid-token")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, model.ProblemTokenInvalid)
 }
 
-func TestPostDeploymentNoToken(t *testing.T) {
+func TestPostDeploymentAsync(t *testing.T) {
 	router := SetupTestEnvironment(t)
 
-	t.Setenv("TESTING_ENABLE_OIDC", "true")
-
 	deployment := &model.Deployment{
 		ApplicationName: "demo-api-go",
 		System:          "core",
@@ -120,43 +176,107 @@ func TestPostDeploymentNoToken(t *testing.T) {
 		t.Fatalf("Failed to marshal deployment: %v", err)
 	}
 
-	// Create a new HTTP request to the /deployment endpoint
 	req, err := http.NewRequest("POST", "/deployment", bytes.NewBuffer(body))
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
 	}
 
+	req.Header.Add("X-Async", "true")
+
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	expectedStatus := http.StatusBadRequest
+	expectedStatus := http.StatusAccepted
 	if status := rr.Code; status != expectedStatus {
-		t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
+		t.Fatalf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
 	}
 
-	expected := `{"error":"X-GitHub-OIDC-Token header is required"}`
-	if rr.Body.String() != expected {
-		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	var accepted struct {
+		ID       string `json:"id"`
+		Location string `json:"location"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	contentType := rr.Header().Get("Content-Type")
-	expectedContentType := "application/json; charset=utf-8"
-	if contentType != expectedContentType {
-		t.Errorf("Handler returned wrong content type: got %v want %v", contentType, expectedContentType)
+	if accepted.ID == "" {
+		t.Fatalf("Handler returned empty job ID")
+	}
+
+	if location := rr.Header().Get("Location"); location != accepted.Location {
+		t.Errorf("Handler returned wrong Location header: got %v want %v", location, accepted.Location)
+	}
+
+	var job struct {
+		Status string                  `json:"status"`
+		Result *model.DeploymentResult `json:"result"`
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		req, err := http.NewRequest("GET", accepted.Location, nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+
+		if err := json.Unmarshal(rr.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if job.Status != "running" {
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if job.Status != "failed" {
+		t.Errorf("Job has wrong status: got %v want %v", job.Status, "failed")
+	}
+
+	if job.Result == nil || job.Result.ErrorType != model.ProblemApplicationNotFound.URI {
+		t.Errorf("Job has unexpected result: got %+v want error type %v", job.Result, model.ProblemApplicationNotFound.URI)
 	}
 }
 
-func TestPostDeploymentInvalidToken(t *testing.T) {
+func TestGetDeploymentNotFound(t *testing.T) {
 	router := SetupTestEnvironment(t)
 
-	t.Setenv("TESTING_ENABLE_OIDC", "true")
+	req, err := http.NewRequest("GET", "/deployment/does-not-exist", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, model.ProblemDeploymentJobNotFound)
+}
+
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r *streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func TestPostDeploymentStream(t *testing.T) {
+	router := SetupTestEnvironment(t)
 
 	deployment := &model.Deployment{
 		ApplicationName: "demo-api-go",
 		System:          "core",
 		ClusterType:     "aks",
 		Environment:     "dev",
-		Image:           "ghcr.io/3lvia/core-demo-api-go@sha256:1234567890abcdef",
+		Image:           "ghcr.io/3lvia/core-demo-api-go:dev@sha256:1234567890abcdef",
 	}
 
 	body, err := json.Marshal(deployment)
@@ -164,30 +284,88 @@ func TestPostDeploymentInvalidToken(t *testing.T) {
 		t.Fatalf("Failed to marshal deployment: %v", err)
 	}
 
-	// Create a new HTTP request to the /deployment endpoint
 	req, err := http.NewRequest("POST", "/deployment", bytes.NewBuffer(body))
 	if err != nil {
 		t.Fatalf("Failed to create request: %v", err)
 	}
 
-	req.Header.Add("X-GitHub-OIDC-Token", "invalid-token")
+	req.Header.Add("Accept", "text/event-stream")
 
-	rr := httptest.NewRecorder()
+	rr := &streamRecorder{httptest.NewRecorder()}
 	router.ServeHTTP(rr, req)
 
-	expectedStatus := http.StatusForbidden
+	expectedStatus := http.StatusOK
 	if status := rr.Code; status != expectedStatus {
 		t.Errorf("Handler returned wrong status code: got %v want %v", status, expectedStatus)
 	}
 
-	expected := `{"error":"invalid token: failed to verify token: token is malformed: token contains an invalid number of segments"}`
+	expected := "event:result\ndata:{\"version\":\"v1\",\"success\":false,\"error\":\"application(s) not found\",\"error_type\":\"urn:deployvia:problem:application-not-found\",\"applications\":[]}\n\n"
 	if rr.Body.String() != expected {
-		t.Errorf("Handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+		t.Errorf("Handler returned unexpected body: got %q want %q", rr.Body.String(), expected)
 	}
 
 	contentType := rr.Header().Get("Content-Type")
-	expectedContentType := "application/json; charset=utf-8"
+	expectedContentType := "text/event-stream;charset=utf-8"
 	if contentType != expectedContentType {
 		t.Errorf("Handler returned wrong content type: got %v want %v", contentType, expectedContentType)
 	}
 }
+
+func TestPostDeploymentTimeoutTooLong(t *testing.T) {
+	t.Setenv("MAX_TIMEOUT", "10m")
+
+	router := SetupTestEnvironment(t)
+
+	deployment := &model.Deployment{
+		ApplicationName: "demo-api-go",
+		System:          "core",
+		ClusterType:     "aks",
+		Environment:     "dev",
+		Image:           "ghcr.io/3lvia/core-demo-api-go:dev@sha256:1234567890abcdef",
+	}
+
+	body, err := json.Marshal(deployment)
+	if err != nil {
+		t.Fatalf("Failed to marshal deployment: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", "/deployment", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	req.Header.Add("X-Timeout", "1h")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, model.ProblemValidationFailed)
+}
+
+func TestGetApplicationsNotFound(t *testing.T) {
+	router := SetupTestEnvironment(t)
+
+	req, err := http.NewRequest("GET", "/applications/core/demo-api-go?environment=dev&cluster_type=aks", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, model.ProblemApplicationNotFound)
+}
+
+func TestGetApplicationsNoEnvironment(t *testing.T) {
+	router := SetupTestEnvironment(t)
+
+	req, err := http.NewRequest("GET", "/applications/core/demo-api-go", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assertProblem(t, rr, model.ProblemValidationFailed)
+}
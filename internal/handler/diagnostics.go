@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var eventGVR = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "events",
+}
+
+var (
+	// How long collecting diagnostics may take, after the deadline of the deployment has passed.
+	diagnosticsTimeout = 10 * time.Second
+	// The size of the diagnostics of each application, and of all applications in a response, encoded as JSON.
+	diagnosticsMaxBytes      = 32 * 1024
+	diagnosticsMaxTotalBytes = 256 * 1024
+	diagnosticsMaxEvents     = 20
+	diagnosticsLogLines      = int64(30)
+	diagnosticsLogBytes      = int64(8 * 1024)
+)
+
+// The reasons of waiting containers that do not start without a change to the pod or image.
+var failingContainerReasons = []string{
+	"CrashLoopBackOff",
+	"ImagePullBackOff",
+	"ErrImagePull",
+	"CreateContainerConfigError",
+	"RunContainerError",
+}
+
+// Collects diagnostics explaining why the application was not deployed, from the application itself,
+// and from its workloads in the cluster it is deployed to if deployvia has access to it.
+// Container logs may contain sensitive data, so they are only read if 'includeLogs' is set.
+// Diagnostics are best effort, so failing to read any of them is only logged.
+func collectDiagnostics(
+	ctx context.Context,
+	applicationClient backend.StatusBackend,
+	workloadClients workloadClients,
+	application *unstructured.Unstructured,
+	includeLogs bool,
+) *model.Diagnostics {
+	ctx, cancel := context.WithTimeout(ctx, diagnosticsTimeout)
+	defer cancel()
+
+	diagnostics := &model.Diagnostics{}
+
+	for _, resource := range backend.GetApplicationResources(application) {
+		if (resource.HealthStatus != "" && resource.HealthStatus != "Healthy") || resource.SyncStatus == "OutOfSync" {
+			diagnostics.Resources = append(diagnostics.Resources, resource)
+		}
+	}
+
+	diagnostics.Resources = addDegradedTreeResources(
+		ctx,
+		applicationClient,
+		application.GetNamespace(),
+		application.GetName(),
+		diagnostics.Resources,
+	)
+
+	conditions, _, _ := unstructured.NestedSlice(application.Object, "status", "conditions")
+	for _, condition := range conditions {
+		conditionMap, ok := condition.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		conditionType, _ := conditionMap["type"].(string)
+		message, _ := conditionMap["message"].(string)
+		diagnostics.Conditions = append(diagnostics.Conditions, model.ApplicationCondition{Type: conditionType, Message: message})
+	}
+
+	var (
+		client    dynamic.Interface
+		clientset kubernetes.Interface
+	)
+	if workloadClients != nil {
+		client, clientset = workloadClients(application)
+	}
+
+	if !includeLogs {
+		clientset = nil
+	}
+
+	if client != nil {
+		addWorkloadDiagnostics(ctx, client, clientset, application, diagnostics)
+	}
+
+	diagnostics.Truncate(diagnosticsMaxBytes)
+
+	return diagnostics
+}
+
+// Cuts the diagnostics of the results to fit 'diagnosticsMaxTotalBytes' together, sharing it evenly between the applications with diagnostics.
+func limitDiagnostics(results []model.ApplicationResult) {
+	var diagnostics []*model.Diagnostics
+	for _, result := range results {
+		if result.Diagnostics != nil {
+			diagnostics = append(diagnostics, result.Diagnostics)
+		}
+	}
+
+	if len(diagnostics) == 0 {
+		return
+	}
+
+	maxBytes := min(diagnosticsMaxBytes, diagnosticsMaxTotalBytes/len(diagnostics))
+	for _, d := range diagnostics {
+		d.Truncate(maxBytes)
+	}
+}
+
+// Adds the recent events and failing pods of the Deployments, StatefulSets and Rollouts in 'status.resources'.
+// Pods are matched through their owner references, to the workload itself or to one of its ReplicaSets with replicas,
+// and events are listed for the workload, those ReplicaSets and pods.
+func addWorkloadDiagnostics(
+	ctx context.Context,
+	client dynamic.Interface,
+	clientset kubernetes.Interface,
+	application *unstructured.Unstructured,
+	diagnostics *model.Diagnostics,
+) {
+	for _, resource := range backend.GetApplicationResources(application) {
+		gvr, ok := workloadGVRs[resource.Group+"/"+resource.Kind]
+		if !ok {
+			continue
+		}
+
+		workload, err := client.Resource(gvr).Namespace(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Warnf("Failed to get %s %s/%s for diagnostics: %v", resource.Kind, resource.Namespace, resource.Name, err)
+			continue
+		}
+
+		owners := []*unstructured.Unstructured{workload}
+
+		// The pods of Deployments and Rollouts are owned by their ReplicaSets, and those scaled down have no pods left.
+		replicaSets, err := getOwnedReplicaSets(ctx, client, workload)
+		if err != nil {
+			log.Warnf("Failed to get replicasets of %s %s/%s for diagnostics: %v", resource.Kind, resource.Namespace, resource.Name, err)
+		}
+
+		for _, replicaSet := range replicaSets {
+			if replicas, _, _ := unstructured.NestedInt64(replicaSet.Object, "spec", "replicas"); replicas > 0 {
+				owners = append(owners, &replicaSet)
+			}
+		}
+
+		pods, err := getWorkloadPods(ctx, client, workload)
+		if err != nil {
+			log.Warnf("Failed to get pods of %s %s/%s for diagnostics: %v", resource.Kind, resource.Namespace, resource.Name, err)
+		}
+
+		involvedObjects := slices.Clone(owners)
+
+		for _, pod := range pods {
+			if !slices.ContainsFunc(owners, func(owner *unstructured.Unstructured) bool {
+				return metav1.IsControlledBy(&pod, owner)
+			}) {
+				continue
+			}
+
+			involvedObjects = append(involvedObjects, &pod)
+
+			if podDiagnostics, ok := getPodDiagnostics(ctx, clientset, &pod); ok {
+				diagnostics.Pods = append(diagnostics.Pods, podDiagnostics)
+			}
+		}
+
+		for _, involvedObject := range involvedObjects {
+			events, err := getEvents(ctx, client, involvedObject)
+			if err != nil {
+				log.Warnf(
+					"Failed to get events of %s %s/%s for diagnostics: %v",
+					involvedObject.GetKind(),
+					involvedObject.GetNamespace(),
+					involvedObject.GetName(),
+					err,
+				)
+
+				continue
+			}
+
+			diagnostics.Events = append(diagnostics.Events, events...)
+		}
+	}
+
+	slices.SortStableFunc(diagnostics.Events, func(a, b model.EventDiagnostics) int {
+		return strings.Compare(b.LastSeen, a.LastSeen)
+	})
+
+	if len(diagnostics.Events) > diagnosticsMaxEvents {
+		diagnostics.Events = diagnostics.Events[:diagnosticsMaxEvents]
+	}
+}
+
+// Returns the containers of the pod that can not start, with the last logs of those that crashed.
+func getPodDiagnostics(ctx context.Context, clientset kubernetes.Interface, pod *unstructured.Unstructured) (model.PodDiagnostics, bool) {
+	podDiagnostics := model.PodDiagnostics{
+		Namespace: pod.GetNamespace(),
+		Name:      pod.GetName(),
+	}
+
+	podDiagnostics.Phase, _, _ = unstructured.NestedString(pod.Object, "status", "phase")
+
+	initContainerStatuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "initContainerStatuses")
+	containerStatuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+
+	for _, containerStatus := range slices.Concat(initContainerStatuses, containerStatuses) {
+		containerStatusMap, ok := containerStatus.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		reason, _, _ := unstructured.NestedString(containerStatusMap, "state", "waiting", "reason")
+		if !slices.Contains(failingContainerReasons, reason) {
+			continue
+		}
+
+		containerDiagnostics := model.ContainerDiagnostics{Reason: reason}
+		containerDiagnostics.Name, _, _ = unstructured.NestedString(containerStatusMap, "name")
+		containerDiagnostics.Message, _, _ = unstructured.NestedString(containerStatusMap, "state", "waiting", "message")
+		containerDiagnostics.RestartCount, _, _ = unstructured.NestedInt64(containerStatusMap, "restartCount")
+
+		if lastTermination, found, _ := unstructured.NestedMap(containerStatusMap, "lastState", "terminated"); found {
+			containerDiagnostics.LastTerminationReason, _, _ = unstructured.NestedString(lastTermination, "reason")
+			containerDiagnostics.LastTerminationMessage, _, _ = unstructured.NestedString(lastTermination, "message")
+
+			if exitCode, found, _ := unstructured.NestedInt64(lastTermination, "exitCode"); found {
+				containerDiagnostics.LastTerminationExitCode = &exitCode
+			}
+		}
+
+		// Only containers that ran have logs, and the current run of a crashing container has not logged anything yet.
+		if clientset != nil && containerDiagnostics.RestartCount > 0 {
+			logs, err := clientset.CoreV1().Pods(pod.GetNamespace()).GetLogs(pod.GetName(), &corev1.PodLogOptions{
+				Container:  containerDiagnostics.Name,
+				Previous:   true,
+				TailLines:  &diagnosticsLogLines,
+				LimitBytes: &diagnosticsLogBytes,
+			}).DoRaw(ctx)
+			if err != nil {
+				log.Warnf("Failed to get logs of container %s in pod %s/%s: %v", containerDiagnostics.Name, pod.GetNamespace(), pod.GetName(), err)
+			} else {
+				containerDiagnostics.Logs = string(logs)
+			}
+		}
+
+		podDiagnostics.Containers = append(podDiagnostics.Containers, containerDiagnostics)
+	}
+
+	return podDiagnostics, len(podDiagnostics.Containers) > 0
+}
+
+// Returns the events of the object.
+func getEvents(ctx context.Context, client dynamic.Interface, obj *unstructured.Unstructured) ([]model.EventDiagnostics, error) {
+	events, err := client.Resource(eventGVR).Namespace(obj.GetNamespace()).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("involvedObject.kind", obj.GetKind()),
+			fields.OneTermEqualSelector("involvedObject.name", obj.GetName()),
+		).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var eventDiagnostics []model.EventDiagnostics
+	for _, event := range events.Items {
+		kind, _, _ := unstructured.NestedString(event.Object, "involvedObject", "kind")
+		name, _, _ := unstructured.NestedString(event.Object, "involvedObject", "name")
+
+		eventType, _, _ := unstructured.NestedString(event.Object, "type")
+		reason, _, _ := unstructured.NestedString(event.Object, "reason")
+		message, _, _ := unstructured.NestedString(event.Object, "message")
+		count, _, _ := unstructured.NestedInt64(event.Object, "count")
+		lastTimestamp, _, _ := unstructured.NestedString(event.Object, "lastTimestamp")
+		eventTime, _, _ := unstructured.NestedString(event.Object, "eventTime")
+
+		eventDiagnostics = append(eventDiagnostics, model.EventDiagnostics{
+			Object:   fmt.Sprintf("%s/%s", kind, name),
+			Type:     eventType,
+			Reason:   reason,
+			Message:  message,
+			Count:    count,
+			LastSeen: cmp.Or(lastTimestamp, eventTime, event.GetCreationTimestamp().UTC().Format(time.RFC3339)),
+		})
+	}
+
+	return eventDiagnostics, nil
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newEvent(name string, kind string, objectName string, reason string, lastTimestamp string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion":     "v1",
+		"kind":           "Event",
+		"metadata":       map[string]any{"name": name, "namespace": "core"},
+		"involvedObject": map[string]any{"kind": kind, "name": objectName},
+		"type":           "Warning",
+		"reason":         reason,
+		"message":        reason + " of " + objectName,
+		"count":          int64(3),
+		"lastTimestamp":  lastTimestamp,
+	}}
+}
+
+// The fake client ignores field selectors, so events are listed by a reactor that applies them like the API server.
+func addEventReactor(client *dynamicfake.FakeDynamicClient, events ...*unstructured.Unstructured) {
+	client.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields
+
+		list := &unstructured.UnstructuredList{Object: map[string]any{"apiVersion": "v1", "kind": "EventList"}}
+		for _, event := range events {
+			kind, _, _ := unstructured.NestedString(event.Object, "involvedObject", "kind")
+			name, _, _ := unstructured.NestedString(event.Object, "involvedObject", "name")
+
+			if event.GetNamespace() == action.GetNamespace() &&
+				selector.Matches(fields.Set{"involvedObject.kind": kind, "involvedObject.name": name}) {
+				list.Items = append(list.Items, *event)
+			}
+		}
+
+		return true, list, nil
+	})
+}
+
+func withPodOwner(pod *unstructured.Unstructured, replicaSet *unstructured.Unstructured) *unstructured.Unstructured {
+	pod.Object["metadata"].(map[string]any)["ownerReferences"] = []any{
+		map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "ReplicaSet",
+			"name":       replicaSet.GetName(),
+			"uid":        string(replicaSet.GetUID()),
+			"controller": true,
+		},
+	}
+
+	return pod
+}
+
+func TestCollectDiagnostics(t *testing.T) {
+	application := newWorkloadApplication()
+	application.Object["status"] = map[string]any{
+		"conditions": []any{
+			map[string]any{"type": "SyncError", "message": "one or more objects failed to apply"},
+		},
+		"resources": []any{
+			map[string]any{
+				"group":     "apps",
+				"kind":      "Deployment",
+				"namespace": "core",
+				"name":      "demo-api",
+				"status":    "Synced",
+				"health":    map[string]any{"status": "Progressing", "message": "waiting for rollout to finish"},
+			},
+			map[string]any{"kind": "Service", "namespace": "core", "name": "demo-api", "status": "Synced", "health": map[string]any{"status": "Healthy"}},
+		},
+	}
+
+	crashingPod := newWorkloadPod("demo-api-7d9f8-abcde", "sha256:1234567890abcdef")
+	crashingPod.Object["status"] = map[string]any{
+		"phase": "Running",
+		"containerStatuses": []any{
+			map[string]any{
+				"name":         "demo-api",
+				"restartCount": int64(4),
+				"state": map[string]any{
+					"waiting": map[string]any{"reason": "CrashLoopBackOff", "message": "back-off 1m20s restarting failed container"},
+				},
+				"lastState": map[string]any{
+					"terminated": map[string]any{"reason": "Error", "exitCode": int64(1)},
+				},
+			},
+			map[string]any{"name": "proxy", "state": map[string]any{"running": map[string]any{}}},
+		},
+	}
+
+	replicaSet := newWorkloadReplicaSet(podTemplateHash, "3")
+
+	// The pods of another workload with the same labels and a name starting with the name of the Deployment are not matched.
+	otherReplicaSet := newWorkloadReplicaSet("1a2b3", "1")
+	otherReplicaSet.SetName("demo-api-worker-1a2b3")
+	otherReplicaSet.SetOwnerReferences(nil)
+
+	otherPod := withPodOwner(newWorkloadPod("demo-api-worker-1a2b3-klmno", previousDigest), otherReplicaSet)
+	otherPod.Object["status"] = crashingPod.Object["status"]
+
+	client := newWorkloadClient(
+		newWorkloadDeployment(workloadImage, 1),
+		replicaSet,
+		otherReplicaSet,
+		withPodOwner(crashingPod, replicaSet),
+		otherPod,
+	)
+	addEventReactor(
+		client,
+		newEvent("demo-api.1", "Pod", "demo-api-7d9f8-abcde", "BackOff", "2025-01-02T03:04:05Z"),
+		newEvent("demo-api.2", "ReplicaSet", "demo-api-7d9f8", "SuccessfulCreate", "2025-01-02T03:00:00Z"),
+		newEvent("demo-api-worker.1", "Pod", "demo-api-worker-1a2b3-klmno", "BackOff", "2025-01-02T03:05:00Z"),
+	)
+	clientset := kubernetesfake.NewClientset()
+
+	diagnostics := collectDiagnostics(
+		context.Background(),
+		newKubernetesBackend(newFakeDynamicClient(application), "argocd"),
+		func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return client, clientset },
+		application,
+		true,
+	)
+
+	if len(diagnostics.Resources) != 1 || diagnostics.Resources[0].Kind != "Deployment" {
+		t.Errorf("collectDiagnostics() resources = %v, expected the progressing Deployment", diagnostics.Resources)
+	}
+
+	if len(diagnostics.Conditions) != 1 || diagnostics.Conditions[0].Type != "SyncError" {
+		t.Errorf("collectDiagnostics() conditions = %v, expected the SyncError", diagnostics.Conditions)
+	}
+
+	expectedEvents := []string{"Pod/demo-api-7d9f8-abcde", "ReplicaSet/demo-api-7d9f8"}
+	if len(diagnostics.Events) != len(expectedEvents) {
+		t.Fatalf("collectDiagnostics() events = %v, expected events of %v", diagnostics.Events, expectedEvents)
+	}
+
+	for i, expectedObject := range expectedEvents {
+		if diagnostics.Events[i].Object != expectedObject {
+			t.Errorf("collectDiagnostics() event %d is of %s, expected %s", i, diagnostics.Events[i].Object, expectedObject)
+		}
+	}
+
+	if len(diagnostics.Pods) != 1 || len(diagnostics.Pods[0].Containers) != 1 {
+		t.Fatalf("collectDiagnostics() pods = %+v, expected the crashing container", diagnostics.Pods)
+	}
+
+	container := diagnostics.Pods[0].Containers[0]
+	if container.Reason != "CrashLoopBackOff" ||
+		container.LastTerminationReason != "Error" ||
+		container.LastTerminationExitCode == nil || *container.LastTerminationExitCode != 1 {
+		t.Errorf("collectDiagnostics() container = %+v, expected CrashLoopBackOff after exit code 1", container)
+	}
+
+	if container.Logs == "" {
+		t.Error("collectDiagnostics() returned no logs of the crashing container")
+	}
+
+	diagnostics = collectDiagnostics(
+		context.Background(),
+		newKubernetesBackend(newFakeDynamicClient(application), "argocd"),
+		func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return client, clientset },
+		application,
+		false,
+	)
+
+	if len(diagnostics.Pods) != 1 || diagnostics.Pods[0].Containers[0].Logs != "" {
+		t.Errorf("collectDiagnostics() pods = %+v, expected no logs unless they are included", diagnostics.Pods)
+	}
+}
+
+func TestCollectDiagnosticsWithoutAccess(t *testing.T) {
+	application := newWorkloadApplication()
+
+	diagnostics := collectDiagnostics(
+		context.Background(),
+		newKubernetesBackend(newFakeDynamicClient(application), "argocd"),
+		func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return nil, nil },
+		application,
+		true,
+	)
+
+	if diagnostics == nil || len(diagnostics.Events) != 0 || len(diagnostics.Pods) != 0 {
+		t.Errorf("collectDiagnostics() = %+v, expected only the diagnostics of the application", diagnostics)
+	}
+}
+
+func TestLimitDiagnostics(t *testing.T) {
+	newDiagnostics := func() *model.Diagnostics {
+		return &model.Diagnostics{
+			Conditions: []model.ApplicationCondition{{Type: "SyncError", Message: strings.Repeat("x", diagnosticsMaxBytes/2)}},
+		}
+	}
+
+	var results []model.ApplicationResult
+	for range 2 * diagnosticsMaxTotalBytes / diagnosticsMaxBytes {
+		results = append(results, model.ApplicationResult{Diagnostics: newDiagnostics()})
+	}
+
+	results = append(results, model.ApplicationResult{})
+
+	limitDiagnostics(results)
+
+	for i, result := range results[:len(results)-1] {
+		if !result.Diagnostics.Truncated || len(result.Diagnostics.Conditions) != 0 {
+			t.Errorf("limitDiagnostics() result %d = %+v, expected the diagnostics to be cut to share the total size", i, result.Diagnostics)
+		}
+	}
+
+	results = []model.ApplicationResult{{Diagnostics: newDiagnostics()}}
+	limitDiagnostics(results)
+
+	if results[0].Diagnostics.Truncated {
+		t.Errorf("limitDiagnostics() = %+v, expected the diagnostics of a single application to fit", results[0].Diagnostics)
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// applicationRef identifies an application in one of the watched namespaces.
+type applicationRef struct {
+	namespace string
+	name      string
+}
+
+// Selects a single application; the namespace is needed when applications are looked up in several namespaces.
+func getApplicationFieldSelector(namespace string, applicationName string) string {
+	return fields.Set{
+		"metadata.namespace": namespace,
+		"metadata.name":      applicationName,
+	}.AsSelector().String()
+}
+
+// Returns a client for the application namespaces of the cluster.
+func getApplicationClients(config *config.Config, cluster *config.Cluster, gvr schema.GroupVersionResource) backend.StatusBackend {
+	// The Argo CD API serves every namespace itself.
+	if cluster.ArgoCD != nil {
+		return withWatchRetry(config, cluster.ArgoCD, strings.Join(cluster.ApplicationNamespaces, ","))
+	}
+
+	if len(cluster.ApplicationNamespaces) == 1 {
+		return getApplicationClient(config, cluster, gvr, cluster.ApplicationNamespaces[0])
+	}
+
+	clients := make(multiNamespaceApplicationClient, len(cluster.ApplicationNamespaces))
+	for _, namespace := range cluster.ApplicationNamespaces {
+		clients[namespace] = getApplicationClient(config, cluster, gvr, namespace)
+	}
+
+	return clients
+}
+
+// multiNamespaceApplicationClient lists applications in several namespaces, keyed by namespace.
+// Watches and resource trees are delegated to the client of the namespace in the 'metadata.namespace' field selector.
+type multiNamespaceApplicationClient map[string]backend.StatusBackend
+
+func (c multiNamespaceApplicationClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	namespaces := make([]string, 0, len(c))
+	for namespace := range c {
+		namespaces = append(namespaces, namespace)
+	}
+
+	slices.Sort(namespaces)
+
+	list := &unstructured.UnstructuredList{}
+	for _, namespace := range namespaces {
+		namespaceList, err := c[namespace].List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+
+		list.Items = append(list.Items, namespaceList.Items...)
+	}
+
+	return list, nil
+}
+
+func (c multiNamespaceApplicationClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector: %w", err)
+	}
+
+	namespace, found := fieldSelector.RequiresExactMatch("metadata.namespace")
+	if !found {
+		return nil, fmt.Errorf("watching applications in several namespaces requires a metadata.namespace field selector")
+	}
+
+	client, ok := c[namespace]
+	if !ok {
+		return nil, fmt.Errorf("namespace %s is not watched", namespace)
+	}
+
+	return client.Watch(ctx, opts)
+}
+
+func (c multiNamespaceApplicationClient) GetResourceTree(
+	ctx context.Context,
+	namespace string,
+	name string,
+) ([]model.ResourceStatus, error) {
+	client, ok := c[namespace]
+	if !ok {
+		return nil, fmt.Errorf("namespace %s is not watched", namespace)
+	}
+
+	return client.GetResourceTree(ctx, namespace, name)
+}
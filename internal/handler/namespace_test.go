@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestMultiNamespaceApplicationClient(t *testing.T) {
+	argocdApplication := newApplication("core-demo-api-dev", nil)
+
+	teamApplication := newApplication("core-demo-api-dev", nil)
+	teamApplication.SetNamespace("team-core")
+
+	client := newFakeDynamicClient(argocdApplication, teamApplication, newApplication("other", nil))
+	applicationClient := multiNamespaceApplicationClient{
+		"argocd":    newKubernetesBackend(client, "argocd"),
+		"team-core": newKubernetesBackend(client, "team-core"),
+	}
+
+	applications, err := applicationClient.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() error = '%v'", err)
+	}
+
+	if len(applications.Items) != 3 {
+		t.Fatalf("List() returned %d applications, expected 3", len(applications.Items))
+	}
+
+	// Namespaces are listed in order, so that results are stable.
+	if namespace := applications.Items[2].GetNamespace(); namespace != "team-core" {
+		t.Errorf("List() returned namespace %s last, expected team-core", namespace)
+	}
+
+	w, err := applicationClient.Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: getApplicationFieldSelector("team-core", "core-demo-api-dev"),
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = '%v'", err)
+	}
+
+	defer w.Stop()
+
+	if err := unstructured.SetNestedField(teamApplication.Object, "Healthy", "status", "health", "status"); err != nil {
+		t.Fatalf("Failed to set health status: %v", err)
+	}
+
+	if _, err := client.Resource(applicationGVR).Namespace("team-core").Update(
+		context.Background(),
+		teamApplication,
+		metav1.UpdateOptions{},
+	); err != nil {
+		t.Fatalf("Failed to update application: %v", err)
+	}
+
+	if evt := <-w.ResultChan(); evt.Type != watch.Modified {
+		t.Errorf("Watch() event = %s, expected %s", evt.Type, watch.Modified)
+	}
+
+	if _, err := applicationClient.Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: "metadata.name=core-demo-api-dev",
+	}); err == nil {
+		t.Errorf("Watch() without namespace returned no error")
+	}
+
+	if _, err := applicationClient.Watch(context.Background(), metav1.ListOptions{
+		FieldSelector: getApplicationFieldSelector("team-other", "core-demo-api-dev"),
+	}); err == nil {
+		t.Errorf("Watch() in unwatched namespace returned no error")
+	}
+}
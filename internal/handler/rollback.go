@@ -0,0 +1,391 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// The annotation listing the IDs of the entries in 'status.history' that deployvia has seen healthy, oldest first.
+// Argo CD records every successful sync in the history, healthy or not, so only these entries are rolled back to.
+const healthyHistoryAnnotation = "deployvia.elvia.no/healthy-history-ids"
+
+// How many healthy history IDs are kept, which is the default number of entries Argo CD keeps in the history.
+const maxHealthyHistoryIDs = 10
+
+// Returns true if the deployment failed in a way that rolling back can fix,
+// i.e. Argo CD reported a failure or the application did not become healthy in time.
+func shouldRollback(err error) bool {
+	var applicationFailedError *model.ApplicationFailedError
+
+	return errors.As(err, &applicationFailedError) ||
+		errors.Is(err, errApplicationTimeout) ||
+		errors.Is(err, errWatchClosed)
+}
+
+// Rolls the application back to the previous revision in its history and waits for the rollback to finish,
+// returning the deployment error annotated with the outcome of the rollback.
+func rollbackApplication(
+	ctx context.Context,
+	client dynamic.Interface,
+	applicationClient backend.StatusBackend,
+	gvr schema.GroupVersionResource,
+	namespace string,
+	applicationName string,
+	timeout time.Duration,
+	deploymentErr error,
+	onUpdate func(model.ApplicationStatus),
+) error {
+	log_ := log.WithFields(log.Fields{
+		"application": applicationName,
+		"namespace":   namespace,
+	})
+
+	application, err := client.Resource(gvr).Namespace(namespace).Get(ctx, applicationName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("%w; rollback failed: failed to get application: %v", deploymentErr, err)
+	}
+
+	rollbackStatus, err := startRollback(ctx, client, gvr, namespace, application)
+	if err != nil {
+		log_.Errorf("Not rolling back application: %v", err)
+
+		if onUpdate != nil {
+			onUpdate(getRollbackApplicationStatus(application, applicationName, &model.RollbackStatus{
+				Finished: true,
+				Error:    err.Error(),
+			}))
+		}
+
+		return fmt.Errorf("%w; rollback failed: %v", deploymentErr, err)
+	}
+
+	log_.Infof("Rolling back application to revision %s (history ID %d)", rollbackStatus.Revision, rollbackStatus.HistoryID)
+
+	if err := watchRollback(ctx, applicationClient, namespace, applicationName, timeout, rollbackStatus, onUpdate); err != nil {
+		log_.Errorf("Rollback failed: %v", err)
+
+		return fmt.Errorf("%w; rollback to revision %s failed: %v", deploymentErr, rollbackStatus.Revision, err)
+	}
+
+	log_.Info("Application was rolled back")
+
+	return fmt.Errorf("%w; rolled back to revision %s", deploymentErr, rollbackStatus.Revision)
+}
+
+// Checks the guardrails and starts a sync operation to the previous revision, like 'argocd app rollback'.
+// Applications with auto-sync enabled are not rolled back, since Argo CD would immediately sync them forward again.
+func startRollback(
+	ctx context.Context,
+	client dynamic.Interface,
+	gvr schema.GroupVersionResource,
+	namespace string,
+	application *unstructured.Unstructured,
+) (*model.RollbackStatus, error) {
+	if automated, found, _ := unstructured.NestedMap(application.Object, "spec", "syncPolicy", "automated"); found {
+		// Auto-sync can be suspended with 'enabled: false' without removing the rest of the automated sync policy.
+		enabled, found, _ := unstructured.NestedBool(automated, "enabled")
+		if !found || enabled {
+			return nil, fmt.Errorf("auto-sync is enabled")
+		}
+	}
+
+	if _, found, _ := unstructured.NestedMap(application.Object, "operation"); found {
+		return nil, fmt.Errorf("an operation is already in progress")
+	}
+
+	historyEntry, err := getRollbackHistoryEntry(application)
+	if err != nil {
+		return nil, err
+	}
+
+	historyID, _, _ := unstructured.NestedInt64(historyEntry, "id")
+
+	sync := map[string]any{
+		"syncStrategy": map[string]any{
+			"hook": map[string]any{},
+		},
+	}
+
+	// Multi-source applications record 'revisions' and 'sources' instead, leaving 'revision' empty.
+	if revision, _, _ := unstructured.NestedString(historyEntry, "revision"); revision != "" {
+		sync["revision"] = revision
+	}
+
+	// The source is recorded in the history, so that we roll back changes to e.g. Helm values as well.
+	if source, found, _ := unstructured.NestedMap(historyEntry, "source"); found {
+		sync["source"] = source
+	}
+
+	if revisions, found, _ := unstructured.NestedStringSlice(historyEntry, "revisions"); found {
+		sync["revisions"] = revisions
+	}
+
+	if sources, found, _ := unstructured.NestedSlice(historyEntry, "sources"); found {
+		sync["sources"] = sources
+	}
+
+	patch := map[string]any{
+		"operation": map[string]any{
+			"initiatedBy": map[string]any{
+				"username": "deployvia",
+			},
+			"info": []any{
+				map[string]any{
+					"name":  "reason",
+					"value": fmt.Sprintf("rollback to history ID %d after failed deployment", historyID),
+				},
+			},
+			"sync": sync,
+		},
+	}
+
+	if err := patchApplication(ctx, client, gvr, namespace, application.GetName(), patch); err != nil {
+		return nil, fmt.Errorf("failed to start rollback: %w", err)
+	}
+
+	return &model.RollbackStatus{
+		HistoryID: historyID,
+		Revision:  getRevision(historyEntry),
+	}, nil
+}
+
+// Returns the newest entry in 'status.history' deployed before the current revision that deployvia has seen healthy.
+// Argo CD records syncs in the history regardless of the health of the application,
+// so after several failed deployments in a row the previous entry is not necessarily one that worked.
+func getRollbackHistoryEntry(application *unstructured.Unstructured) (map[string]any, error) {
+	history, _, _ := unstructured.NestedSlice(application.Object, "status", "history")
+
+	currentRevision := getSyncRevision(application)
+	healthyHistoryIDs := getHealthyHistoryIDs(application)
+
+	for i := len(history) - 1; i >= 0; i-- {
+		historyEntry, ok := history[i].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		revision := getRevision(historyEntry)
+		if revision == "" || revision == currentRevision {
+			continue
+		}
+
+		if historyID, _, _ := unstructured.NestedInt64(historyEntry, "id"); !slices.Contains(healthyHistoryIDs, historyID) {
+			continue
+		}
+
+		return historyEntry, nil
+	}
+
+	return nil, fmt.Errorf("no previous revision in history has been seen healthy by deployvia")
+}
+
+// Records the entry in 'status.history' of the revision the application is synced to as healthy,
+// so that failed deployments can be rolled back to it later.
+func recordHealthyHistoryEntry(
+	ctx context.Context,
+	client dynamic.Interface,
+	gvr schema.GroupVersionResource,
+	application *unstructured.Unstructured,
+) error {
+	history, _, _ := unstructured.NestedSlice(application.Object, "status", "history")
+	currentRevision := getSyncRevision(application)
+
+	var historyID int64
+	for i := len(history) - 1; i >= 0; i-- {
+		historyEntry, ok := history[i].(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if getRevision(historyEntry) == currentRevision {
+			historyID, _, _ = unstructured.NestedInt64(historyEntry, "id")
+
+			break
+		}
+	}
+
+	healthyHistoryIDs := getHealthyHistoryIDs(application)
+	if currentRevision == "" || historyID == 0 || slices.Contains(healthyHistoryIDs, historyID) {
+		return nil
+	}
+
+	healthyHistoryIDs = append(healthyHistoryIDs, historyID)
+	if len(healthyHistoryIDs) > maxHealthyHistoryIDs {
+		healthyHistoryIDs = healthyHistoryIDs[len(healthyHistoryIDs)-maxHealthyHistoryIDs:]
+	}
+
+	ids := make([]string, 0, len(healthyHistoryIDs))
+	for _, id := range healthyHistoryIDs {
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+
+	patch := map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]any{
+				healthyHistoryAnnotation: strings.Join(ids, ","),
+			},
+		},
+	}
+
+	if err := patchApplication(ctx, client, gvr, application.GetNamespace(), application.GetName(), patch); err != nil {
+		return fmt.Errorf("failed to record healthy history entry %d: %w", historyID, err)
+	}
+
+	return nil
+}
+
+// Returns true if the application is synced and healthy without running the image of the deployment yet,
+// i.e. it is synced to the revision that was running before the deployment.
+func isHealthyBeforeDeployment(application *unstructured.Unstructured, image string) bool {
+	syncStatus, _, _ := unstructured.NestedString(application.Object, "status", "sync", "status")
+	healthStatus, _, _ := unstructured.NestedString(application.Object, "status", "health", "status")
+	images, _, _ := unstructured.NestedStringSlice(application.Object, "status", "summary", "images")
+
+	return syncStatus == "Synced" && healthStatus == "Healthy" && !slices.Contains(images, image)
+}
+
+// Returns the revision of a history entry or sync operation, or the revisions of the sources joined with ',' for multi-source applications,
+// which set 'revisions' and leave 'revision' empty.
+func getRevision(obj map[string]any) string {
+	if revisions, _, _ := unstructured.NestedStringSlice(obj, "revisions"); len(revisions) > 0 {
+		return strings.Join(revisions, ",")
+	}
+
+	revision, _, _ := unstructured.NestedString(obj, "revision")
+
+	return revision
+}
+
+// Returns the revision the application is synced to, as returned by 'getRevision'.
+func getSyncRevision(application *unstructured.Unstructured) string {
+	sync, _, _ := unstructured.NestedMap(application.Object, "status", "sync")
+
+	return getRevision(sync)
+}
+
+func getHealthyHistoryIDs(application *unstructured.Unstructured) []int64 {
+	var healthyHistoryIDs []int64
+	for id := range strings.SplitSeq(application.GetAnnotations()[healthyHistoryAnnotation], ",") {
+		if historyID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64); err == nil {
+			healthyHistoryIDs = append(healthyHistoryIDs, historyID)
+		}
+	}
+
+	return healthyHistoryIDs
+}
+
+// Waits for the rollback operation to finish with a healthy application.
+func watchRollback(
+	ctx context.Context,
+	applicationClient backend.StatusBackend,
+	namespace string,
+	applicationName string,
+	timeout time.Duration,
+	rollbackStatus *model.RollbackStatus,
+	onUpdate func(model.ApplicationStatus),
+) error {
+	w, err := applicationClient.Watch(
+		ctx,
+		metav1.ListOptions{
+			FieldSelector: getApplicationFieldSelector(namespace, applicationName),
+		},
+	)
+	if err != nil {
+		return &model.WatchFailedError{Err: fmt.Errorf("failed to watch application: %w", err)}
+	}
+
+	defer w.Stop()
+
+	update := func(obj *unstructured.Unstructured, err error) error {
+		rollbackStatus.Finished = true
+		rollbackStatus.Succeeded = err == nil
+		if err != nil {
+			rollbackStatus.Error = err.Error()
+		}
+
+		if onUpdate != nil && obj != nil {
+			onUpdate(getRollbackApplicationStatus(obj, applicationName, rollbackStatus))
+		}
+
+		return err
+	}
+
+	var lastObj *unstructured.Unstructured
+
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return update(lastObj, ctx.Err())
+		case evt, ok := <-w.ResultChan():
+			if !ok {
+				return update(lastObj, errWatchClosed)
+			}
+
+			obj, ok := evt.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+
+			lastObj = obj
+
+			// Ignore the operation state of the failed deployment until Argo CD has picked up the rollback.
+			operationSync, _, _ := unstructured.NestedMap(obj.Object, "status", "operationState", "operation", "sync")
+			if getRevision(operationSync) != rollbackStatus.Revision {
+				continue
+			}
+
+			phase, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "phase")
+			healthStatus, _, _ := unstructured.NestedString(obj.Object, "status", "health", "status")
+
+			switch {
+			case phase == "Failed" || phase == "Error":
+				message, _, _ := unstructured.NestedString(obj.Object, "status", "operationState", "message")
+
+				return update(obj, fmt.Errorf("sync operation failed: %s", message))
+			case phase == "Succeeded" && healthStatus == "Healthy":
+				return update(obj, nil)
+			case onUpdate != nil:
+				onUpdate(getRollbackApplicationStatus(obj, applicationName, rollbackStatus))
+			}
+		case <-deadline:
+			return update(lastObj, errApplicationTimeout)
+		}
+	}
+}
+
+func getRollbackApplicationStatus(
+	obj *unstructured.Unstructured,
+	applicationName string,
+	rollbackStatus *model.RollbackStatus,
+) model.ApplicationStatus {
+	status := model.ApplicationStatus{
+		Name:      applicationName,
+		Namespace: obj.GetNamespace(),
+		Rollback:  new(model.RollbackStatus),
+	}
+
+	*status.Rollback = *rollbackStatus
+
+	status.ClusterType, _, _ = unstructured.NestedString(obj.Object, "metadata", "labels", "elvia.no/cluster-type")
+	status.SyncStatus, _, _ = unstructured.NestedString(obj.Object, "status", "sync", "status")
+	status.HealthStatus, _, _ = unstructured.NestedString(obj.Object, "status", "health", "status")
+	status.Images, _, _ = unstructured.NestedStringSlice(obj.Object, "status", "summary", "images")
+	status.Revision = getSyncRevision(obj)
+
+	return status
+}
@@ -0,0 +1,291 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newRollbackApplication(syncPolicy map[string]any, healthyHistoryIDs string) *unstructured.Unstructured {
+	application := newApplication("core-demo-api-dev", nil)
+	application.SetAnnotations(map[string]string{healthyHistoryAnnotation: healthyHistoryIDs})
+	application.Object["spec"] = map[string]any{"syncPolicy": syncPolicy}
+	application.Object["status"] = map[string]any{
+		"sync": map[string]any{"status": "Synced", "revision": "ccc"},
+		"history": []any{
+			map[string]any{"id": int64(1), "revision": "aaa"},
+			map[string]any{
+				"id":       int64(2),
+				"revision": "bbb",
+				"source":   map[string]any{"repoURL": "https://github.com/3lvia/core-applications", "path": "demo-api"},
+			},
+			map[string]any{"id": int64(3), "revision": "ccc"},
+		},
+	}
+
+	return application
+}
+
+func TestStartRollback(t *testing.T) {
+	tests := []struct {
+		name              string
+		syncPolicy        map[string]any
+		healthyHistoryIDs string
+		expectedRevision  string
+		expectedHistoryID int64
+		expectError       bool
+	}{
+		{
+			name:              "manual sync",
+			syncPolicy:        map[string]any{},
+			healthyHistoryIDs: "1,2",
+			expectedRevision:  "bbb",
+			expectedHistoryID: 2,
+		},
+		{
+			name: "auto-sync suspended",
+			syncPolicy: map[string]any{
+				"automated": map[string]any{"enabled": false, "prune": true},
+			},
+			healthyHistoryIDs: "1,2",
+			expectedRevision:  "bbb",
+			expectedHistoryID: 2,
+		},
+		{
+			name: "auto-sync enabled",
+			syncPolicy: map[string]any{
+				"automated": map[string]any{"prune": true},
+			},
+			healthyHistoryIDs: "1,2",
+			expectError:       true,
+		},
+		{
+			name:              "previous revision was never healthy",
+			syncPolicy:        map[string]any{},
+			healthyHistoryIDs: "1",
+			expectedRevision:  "aaa",
+			expectedHistoryID: 1,
+		},
+		{
+			name:        "no revision was healthy",
+			syncPolicy:  map[string]any{},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			application := newRollbackApplication(tt.syncPolicy, tt.healthyHistoryIDs)
+			client := newFakeDynamicClient(application)
+
+			rollbackStatus, err := startRollback(ctx, client, applicationGVR, "argocd", application)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("startRollback() error = '%v', expectError %v", err, tt.expectError)
+			}
+
+			patched, err := client.Resource(applicationGVR).Namespace("argocd").Get(
+				ctx,
+				"core-demo-api-dev",
+				metav1.GetOptions{},
+			)
+			if err != nil {
+				t.Fatalf("Failed to get application: %v", err)
+			}
+
+			revision, _, _ := unstructured.NestedString(patched.Object, "operation", "sync", "revision")
+			if revision != tt.expectedRevision {
+				t.Errorf("startRollback() operation revision = '%s', expected '%s'", revision, tt.expectedRevision)
+			}
+
+			if tt.expectError {
+				return
+			}
+
+			if rollbackStatus.Revision != tt.expectedRevision || rollbackStatus.HistoryID != tt.expectedHistoryID {
+				t.Errorf(
+					"startRollback() = %+v, expected revision %s and history ID %d",
+					rollbackStatus,
+					tt.expectedRevision,
+					tt.expectedHistoryID,
+				)
+			}
+
+			if _, found, _ := unstructured.NestedMap(patched.Object, "operation", "sync", "source"); !found && tt.expectedHistoryID == 2 {
+				t.Errorf("startRollback() did not roll back the source")
+			}
+		})
+	}
+}
+
+func TestStartRollbackMultiSource(t *testing.T) {
+	ctx := context.Background()
+	sources := []any{
+		map[string]any{"repoURL": "https://github.com/3lvia/core-applications", "path": "demo-api"},
+		map[string]any{"repoURL": "https://github.com/3lvia/core-values", "ref": "values"},
+	}
+
+	application := newRollbackApplication(map[string]any{}, "1,2")
+	application.Object["status"] = map[string]any{
+		"sync": map[string]any{"status": "Synced", "revisions": []any{"ccc", "zzz"}},
+		"history": []any{
+			map[string]any{"id": int64(1), "revisions": []any{"aaa", "xxx"}, "sources": sources},
+			map[string]any{"id": int64(2), "revisions": []any{"bbb", "yyy"}, "sources": sources},
+			map[string]any{"id": int64(3), "revisions": []any{"ccc", "zzz"}, "sources": sources},
+		},
+	}
+
+	client := newFakeDynamicClient(application)
+
+	rollbackStatus, err := startRollback(ctx, client, applicationGVR, "argocd", application)
+	if err != nil {
+		t.Fatalf("startRollback() error = '%v'", err)
+	}
+
+	if rollbackStatus.Revision != "bbb,yyy" || rollbackStatus.HistoryID != 2 {
+		t.Errorf("startRollback() = %+v, expected revisions bbb,yyy and history ID 2", rollbackStatus)
+	}
+
+	patched, _ := client.Resource(applicationGVR).Namespace("argocd").Get(ctx, "core-demo-api-dev", metav1.GetOptions{})
+
+	revisions, _, _ := unstructured.NestedStringSlice(patched.Object, "operation", "sync", "revisions")
+	patchedSources, _, _ := unstructured.NestedSlice(patched.Object, "operation", "sync", "sources")
+	_, hasRevision, _ := unstructured.NestedString(patched.Object, "operation", "sync", "revision")
+
+	if len(revisions) != 2 || revisions[0] != "bbb" || len(patchedSources) != 2 || hasRevision {
+		t.Errorf("startRollback() operation = %v, expected the revisions and sources of history ID 2", patched.Object["operation"])
+	}
+
+	if err := recordHealthyHistoryEntry(ctx, client, applicationGVR, application); err != nil {
+		t.Fatalf("recordHealthyHistoryEntry() error = '%v'", err)
+	}
+
+	patched, _ = client.Resource(applicationGVR).Namespace("argocd").Get(ctx, "core-demo-api-dev", metav1.GetOptions{})
+	if healthyHistoryIDs := patched.GetAnnotations()[healthyHistoryAnnotation]; healthyHistoryIDs != "1,2,3" {
+		t.Errorf("recordHealthyHistoryEntry() recorded '%s', expected '1,2,3'", healthyHistoryIDs)
+	}
+}
+
+func TestRecordHealthyHistoryEntry(t *testing.T) {
+	ctx := context.Background()
+	application := newRollbackApplication(map[string]any{}, "1,2")
+	client := newFakeDynamicClient(application)
+
+	for range 2 {
+		if err := recordHealthyHistoryEntry(ctx, client, applicationGVR, application); err != nil {
+			t.Fatalf("recordHealthyHistoryEntry() error = '%v'", err)
+		}
+
+		application, _ = client.Resource(applicationGVR).Namespace("argocd").Get(ctx, "core-demo-api-dev", metav1.GetOptions{})
+	}
+
+	if healthyHistoryIDs := application.GetAnnotations()[healthyHistoryAnnotation]; healthyHistoryIDs != "1,2,3" {
+		t.Errorf("recordHealthyHistoryEntry() recorded '%s', expected '1,2,3'", healthyHistoryIDs)
+	}
+}
+
+func TestWatchRollback(t *testing.T) {
+	withOperationState := func(revision string, phase string, healthStatus string) *unstructured.Unstructured {
+		application := newApplication("core-demo-api-dev", nil)
+		application.Object["status"] = map[string]any{
+			"health": map[string]any{"status": healthStatus},
+			"sync":   map[string]any{"status": "OutOfSync"},
+			"operationState": map[string]any{
+				"phase":     phase,
+				"operation": map[string]any{"sync": map[string]any{"revision": revision}},
+			},
+		}
+
+		return application
+	}
+
+	tests := []struct {
+		name        string
+		events      []*unstructured.Unstructured
+		expectError bool
+	}{
+		{
+			name: "rollback succeeds",
+			events: []*unstructured.Unstructured{
+				withOperationState("ccc", "Failed", "Degraded"),
+				withOperationState("bbb", "Running", "Progressing"),
+				withOperationState("bbb", "Succeeded", "Healthy"),
+			},
+		},
+		{
+			name: "rollback fails",
+			events: []*unstructured.Unstructured{
+				withOperationState("bbb", "Running", "Progressing"),
+				withOperationState("bbb", "Failed", "Degraded"),
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeWatcher := watch.NewFake()
+			client := newFakeDynamicClient()
+			client.PrependWatchReactor("applications", func(k8stesting.Action) (bool, watch.Interface, error) {
+				return true, fakeWatcher, nil
+			})
+
+			go func() {
+				for _, event := range tt.events {
+					fakeWatcher.Modify(event)
+				}
+			}()
+
+			var updates []model.ApplicationStatus
+			rollbackStatus := &model.RollbackStatus{HistoryID: 2, Revision: "bbb"}
+
+			err := watchRollback(
+				context.Background(),
+				newKubernetesBackend(client, "argocd"),
+				"argocd",
+				"core-demo-api-dev",
+				10*time.Second,
+				rollbackStatus,
+				func(status model.ApplicationStatus) {
+					updates = append(updates, status)
+				},
+			)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("watchRollback() error = '%v', expectError %v", err, tt.expectError)
+			}
+
+			if !rollbackStatus.Finished || rollbackStatus.Succeeded == tt.expectError {
+				t.Errorf("watchRollback() status = %+v, expected finished with succeeded %v", rollbackStatus, !tt.expectError)
+			}
+
+			if len(updates) != len(tt.events)-1 && !tt.expectError {
+				t.Errorf("watchRollback() sent %d updates, expected %d", len(updates), len(tt.events)-1)
+			}
+
+			if last := updates[len(updates)-1]; last.Rollback == nil || !last.Rollback.Finished {
+				t.Errorf("watchRollback() last update = %+v, expected finished rollback", last)
+			}
+		})
+	}
+}
+
+func TestShouldRollback(t *testing.T) {
+	if !shouldRollback(&model.ApplicationFailedError{Reason: model.FailureReasonDegraded}) {
+		t.Errorf("shouldRollback() = false for degraded application")
+	}
+
+	if !shouldRollback(errApplicationTimeout) {
+		t.Errorf("shouldRollback() = false for timeout")
+	}
+
+	if shouldRollback(errors.New("application(s) not found")) {
+		t.Errorf("shouldRollback() = true for missing application")
+	}
+}
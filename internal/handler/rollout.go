@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var analysisRunGVR = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "analysisruns",
+}
+
+// The pause reasons of a rollout waiting to be promoted, as opposed to e.g. an inconclusive analysis.
+var rolloutPromotionPauseReasons = []string{"CanaryPauseStep", "BlueGreenPause"}
+
+// Returns the progress of the Argo Rollouts in 'status.resources' that run the image.
+// Rollouts are read in the cluster the application is deployed to, falling back to the health reported by Argo CD without access to it.
+func getRollouts(
+	ctx context.Context,
+	workloadClients workloadClients,
+	application *unstructured.Unstructured,
+	image string,
+) []model.RolloutStatus {
+	var client dynamic.Interface
+	if workloadClients != nil {
+		client, _ = workloadClients(application)
+	}
+
+	var rollouts []model.RolloutStatus
+	for _, resource := range backend.GetApplicationResources(application) {
+		if resource.Group != rolloutGVR.Group || resource.Kind != "Rollout" {
+			continue
+		}
+
+		rolloutStatus := model.RolloutStatus{
+			Namespace: resource.Namespace,
+			Name:      resource.Name,
+			Phase:     resource.HealthStatus,
+			Message:   resource.HealthMessage,
+			Paused:    resource.HealthStatus == "Suspended",
+		}
+
+		if client == nil {
+			rollouts = append(rollouts, rolloutStatus)
+			continue
+		}
+
+		rollout, err := client.Resource(rolloutGVR).Namespace(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Warnf("Failed to get rollout %s/%s: %v", resource.Namespace, resource.Name, err)
+			}
+
+			rollouts = append(rollouts, rolloutStatus)
+			continue
+		}
+
+		// Rollouts referencing a Deployment with 'workloadRef' have no pod template of their own.
+		_, hasWorkloadRef, _ := unstructured.NestedMap(rollout.Object, "spec", "workloadRef")
+		if !hasWorkloadRef && len(getContainersRunningImage(rollout, image)) == 0 {
+			continue
+		}
+
+		rollouts = append(rollouts, getRolloutStatus(ctx, client, rollout))
+	}
+
+	return rollouts
+}
+
+func getRolloutStatus(ctx context.Context, client dynamic.Interface, rollout *unstructured.Unstructured) model.RolloutStatus {
+	rolloutStatus := model.RolloutStatus{
+		Namespace: rollout.GetNamespace(),
+		Name:      rollout.GetName(),
+	}
+
+	rolloutStatus.Phase, _, _ = unstructured.NestedString(rollout.Object, "status", "phase")
+	rolloutStatus.Message, _, _ = unstructured.NestedString(rollout.Object, "status", "message")
+	rolloutStatus.Aborted, _, _ = unstructured.NestedBool(rollout.Object, "status", "abort")
+	rolloutStatus.PodHash, _, _ = unstructured.NestedString(rollout.Object, "status", "currentPodHash")
+
+	pauseConditions, _, _ := unstructured.NestedSlice(rollout.Object, "status", "pauseConditions")
+	for _, pauseCondition := range pauseConditions {
+		pauseConditionMap, ok := pauseCondition.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if reason, _ := pauseConditionMap["reason"].(string); slices.Contains(rolloutPromotionPauseReasons, reason) {
+			rolloutStatus.Paused = true
+		}
+	}
+
+	if steps, found, _ := unstructured.NestedSlice(rollout.Object, "spec", "strategy", "canary", "steps"); found {
+		rolloutStatus.Strategy = "canary"
+		rolloutStatus.Steps = int64(len(steps))
+
+		if currentStep, found, _ := unstructured.NestedInt64(rollout.Object, "status", "currentStepIndex"); found {
+			rolloutStatus.CurrentStep = &currentStep
+
+			weight := getCanaryWeight(rollout, steps, currentStep)
+			rolloutStatus.Weight = &weight
+		}
+	} else if _, found, _ := unstructured.NestedMap(rollout.Object, "spec", "strategy", "canary"); found {
+		rolloutStatus.Strategy = "canary"
+	} else if _, found, _ := unstructured.NestedMap(rollout.Object, "spec", "strategy", "blueGreen"); found {
+		rolloutStatus.Strategy = "blueGreen"
+	}
+
+	analysisRuns, err := getAnalysisRuns(ctx, client, rollout)
+	if err != nil {
+		log.Warnf("Failed to get analysis runs of rollout %s/%s: %v", rollout.GetNamespace(), rollout.GetName(), err)
+	}
+
+	rolloutStatus.AnalysisRuns = analysisRuns
+
+	return rolloutStatus
+}
+
+// Returns the weight of the canary, as reported with traffic routing, or set by the last 'setWeight' step before the current step.
+func getCanaryWeight(rollout *unstructured.Unstructured, steps []any, currentStep int64) int64 {
+	if weight, found, _ := unstructured.NestedInt64(rollout.Object, "status", "canary", "weights", "canary", "weight"); found {
+		return weight
+	}
+
+	if currentStep >= int64(len(steps)) {
+		return 100
+	}
+
+	var weight int64
+	for _, step := range steps[:currentStep] {
+		stepMap, ok := step.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if setWeight, found, _ := unstructured.NestedInt64(stepMap, "setWeight"); found {
+			weight = setWeight
+		}
+	}
+
+	return weight
+}
+
+// Returns the AnalysisRuns of the current revision of the rollout, which are labeled with its pod template hash.
+func getAnalysisRuns(ctx context.Context, client dynamic.Interface, rollout *unstructured.Unstructured) ([]model.AnalysisRunStatus, error) {
+	podHash, found, _ := unstructured.NestedString(rollout.Object, "status", "currentPodHash")
+	if !found || podHash == "" {
+		return nil, nil
+	}
+
+	analysisRuns, err := client.Resource(analysisRunGVR).Namespace(rollout.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("rollouts-pod-template-hash=%s", podHash),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var analysisRunStatuses []model.AnalysisRunStatus
+	for _, analysisRun := range analysisRuns.Items {
+		if !slices.ContainsFunc(analysisRun.GetOwnerReferences(), func(ownerReference metav1.OwnerReference) bool {
+			return ownerReference.Kind == "Rollout" && ownerReference.Name == rollout.GetName()
+		}) {
+			continue
+		}
+
+		phase, _, _ := unstructured.NestedString(analysisRun.Object, "status", "phase")
+		message, _, _ := unstructured.NestedString(analysisRun.Object, "status", "message")
+
+		// The message of the run is often empty, while the failed metric explains why.
+		if message == "" && (phase == "Failed" || phase == "Error") {
+			metricResults, _, _ := unstructured.NestedSlice(analysisRun.Object, "status", "metricResults")
+			for _, metricResult := range metricResults {
+				metricResultMap, ok := metricResult.(map[string]any)
+				if !ok || metricResultMap["phase"] != phase {
+					continue
+				}
+
+				name, _ := metricResultMap["name"].(string)
+				metricMessage, _ := metricResultMap["message"].(string)
+				message = fmt.Sprintf("metric %s assessed %s", name, phase)
+				if metricMessage != "" {
+					message = fmt.Sprintf("%s: %s", message, metricMessage)
+				}
+
+				break
+			}
+		}
+
+		analysisRunStatuses = append(analysisRunStatuses, model.AnalysisRunStatus{
+			Name:    analysisRun.GetName(),
+			Phase:   phase,
+			Message: message,
+		})
+	}
+
+	slices.SortFunc(analysisRunStatuses, func(a, b model.AnalysisRunStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return analysisRunStatuses, nil
+}
+
+// Returns an error if a rollout was aborted or one of its AnalysisRuns failed,
+// since the rollout does not continue without being retried.
+// Until a rollout observes the new revision, it still reports the abort and AnalysisRuns of the previous one,
+// so it is only considered once the image is deployed, or once its pod hash has changed from the one it had when the watch started.
+func getRolloutFailure(
+	rollouts []model.RolloutStatus,
+	imageDeployed bool,
+	initialPodHashes map[string]string,
+) *model.ApplicationFailedError {
+	for _, rollout := range rollouts {
+		initialPodHash, found := initialPodHashes[rolloutKey(rollout)]
+		if !imageDeployed && (!found || rollout.PodHash == initialPodHash) {
+			continue
+		}
+
+		if slices.ContainsFunc(rollout.AnalysisRuns, func(analysisRun model.AnalysisRunStatus) bool {
+			return analysisRun.Phase == "Failed" || analysisRun.Phase == "Error"
+		}) {
+			return &model.ApplicationFailedError{Reason: model.FailureReasonAnalysisFailed, Message: rollout.String()}
+		}
+
+		if rollout.Aborted {
+			return &model.ApplicationFailedError{Reason: model.FailureReasonRolloutAborted, Message: rollout.String()}
+		}
+	}
+
+	return nil
+}
+
+// Records the pod hash of the rollouts that are seen for the first time.
+func recordInitialPodHashes(initialPodHashes map[string]string, rollouts []model.RolloutStatus) {
+	for _, rollout := range rollouts {
+		if _, found := initialPodHashes[rolloutKey(rollout)]; !found {
+			initialPodHashes[rolloutKey(rollout)] = rollout.PodHash
+		}
+	}
+}
+
+func rolloutKey(rollout model.RolloutStatus) string {
+	return rollout.Namespace + "/" + rollout.Name
+}
+
+// Returns whether every rollout is paused waiting to be promoted.
+func rolloutsPaused(rollouts []model.RolloutStatus) bool {
+	return len(rollouts) > 0 && !slices.ContainsFunc(rollouts, func(rollout model.RolloutStatus) bool {
+		return !rollout.Paused || rollout.Aborted
+	})
+}
@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newRolloutApplication(healthStatus string) *unstructured.Unstructured {
+	application := newApplication("core-demo-api-dev-aks", nil)
+	application.SetLabels(map[string]string{
+		"elvia.no/system":           "core",
+		"elvia.no/application":      "demo-api",
+		"kubernetes.io/environment": "dev",
+		"elvia.no/cluster-type":     "aks",
+	})
+	application.Object["status"] = map[string]any{
+		"sync":    map[string]any{"status": "Synced"},
+		"health":  map[string]any{"status": healthStatus},
+		"summary": map[string]any{"images": []any{workloadImage}},
+		"resources": []any{
+			map[string]any{
+				"group":     "argoproj.io",
+				"kind":      "Rollout",
+				"namespace": "core",
+				"name":      "demo-api",
+				"health":    map[string]any{"status": healthStatus, "message": "CanaryPauseStep"},
+			},
+		},
+	}
+
+	return application
+}
+
+func newRollout(status map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Rollout",
+		"metadata":   map[string]any{"name": "demo-api", "namespace": "core"},
+		"spec": map[string]any{
+			"strategy": map[string]any{
+				"canary": map[string]any{
+					"steps": []any{
+						map[string]any{"setWeight": int64(20)},
+						map[string]any{"pause": map[string]any{}},
+						map[string]any{"setWeight": int64(50)},
+						map[string]any{"pause": map[string]any{"duration": "10m"}},
+					},
+				},
+			},
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "demo-api", "image": workloadImage}},
+				},
+			},
+		},
+		"status": status,
+	}}
+}
+
+func newAnalysisRun(name string, rolloutName string, phase string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "AnalysisRun",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": "core",
+			"labels":    map[string]any{"rollouts-pod-template-hash": "7d9f8"},
+			"ownerReferences": []any{
+				map[string]any{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout", "name": rolloutName, "uid": "uid-1"},
+			},
+		},
+		"status": map[string]any{
+			"phase": phase,
+			"metricResults": []any{
+				map[string]any{"name": "error-rate", "phase": phase, "message": "error rate 0.12 above 0.05"},
+			},
+		},
+	}}
+}
+
+func TestGetRollouts(t *testing.T) {
+	pausedStatus := map[string]any{
+		"phase":            "Paused",
+		"message":          "CanaryPauseStep",
+		"currentStepIndex": int64(1),
+		"currentPodHash":   "7d9f8",
+		"pauseConditions":  []any{map[string]any{"reason": "CanaryPauseStep"}},
+	}
+
+	abortedStatus := map[string]any{
+		"phase":            "Degraded",
+		"message":          "RolloutAborted: Rollout aborted update to revision 3",
+		"abort":            true,
+		"currentStepIndex": int64(0),
+		"currentPodHash":   "7d9f8",
+	}
+
+	tests := []struct {
+		name            string
+		objects         []runtime.Object
+		noAccess        bool
+		expectedPaused  bool
+		expectedWeight  int64
+		expectedRuns    int
+		expectedFailure string
+	}{
+		{
+			name: "paused at canary step",
+			objects: []runtime.Object{
+				newRollout(pausedStatus),
+				newAnalysisRun("demo-api-7d9f8-1", "demo-api", "Successful"),
+				newAnalysisRun("other-api-7d9f8-1", "other-api", "Failed"),
+			},
+			expectedPaused: true,
+			expectedWeight: 20,
+			expectedRuns:   1,
+		},
+		{
+			name: "analysis failed",
+			objects: []runtime.Object{
+				newRollout(abortedStatus),
+				newAnalysisRun("demo-api-7d9f8-1", "demo-api", "Failed"),
+			},
+			expectedRuns:    1,
+			expectedFailure: model.FailureReasonAnalysisFailed,
+		},
+		{
+			name:            "aborted",
+			objects:         []runtime.Object{newRollout(abortedStatus)},
+			expectedFailure: model.FailureReasonRolloutAborted,
+		},
+		{
+			name:           "no access to the destination",
+			noAccess:       true,
+			expectedPaused: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newWorkloadClient(tt.objects...)
+
+			rollouts := getRollouts(
+				context.Background(),
+				func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) {
+					if tt.noAccess {
+						return nil, nil
+					}
+
+					return client, nil
+				},
+				newRolloutApplication("Suspended"),
+				workloadImage,
+			)
+			if len(rollouts) != 1 {
+				t.Fatalf("getRollouts() returned %d rollouts, expected 1", len(rollouts))
+			}
+
+			rollout := rollouts[0]
+			if rollout.Paused != tt.expectedPaused || rolloutsPaused(rollouts) != tt.expectedPaused {
+				t.Errorf("getRollouts() paused = %t, expected %t: %s", rollout.Paused, tt.expectedPaused, rollout)
+			}
+
+			if !tt.noAccess && (rollout.Weight == nil || *rollout.Weight != tt.expectedWeight) {
+				t.Errorf("getRollouts() weight = %v, expected %d", rollout.Weight, tt.expectedWeight)
+			}
+
+			if len(rollout.AnalysisRuns) != tt.expectedRuns {
+				t.Errorf("getRollouts() returned %d analysis runs, expected %d", len(rollout.AnalysisRuns), tt.expectedRuns)
+			}
+
+			err := getRolloutFailure(rollouts, true, nil)
+			if tt.expectedFailure == "" {
+				if err != nil {
+					t.Errorf("getRolloutFailure() error = '%v', expected none", err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Reason != tt.expectedFailure {
+				t.Errorf("getRolloutFailure() error = '%v', expected reason %s", err, tt.expectedFailure)
+			}
+		})
+	}
+}
+
+func TestGetRolloutFailure(t *testing.T) {
+	aborted := model.RolloutStatus{Namespace: "core", Name: "demo-api", Phase: "Degraded", Aborted: true, PodHash: "7d9f8"}
+
+	tests := []struct {
+		name             string
+		imageDeployed    bool
+		initialPodHashes map[string]string
+		expectedFailure  bool
+	}{
+		{
+			name:            "image deployed",
+			imageDeployed:   true,
+			expectedFailure: true,
+		},
+		{
+			name:             "abort of the previous revision",
+			initialPodHashes: map[string]string{"core/demo-api": "7d9f8"},
+		},
+		{
+			name:             "pod hash changed since the watch started",
+			initialPodHashes: map[string]string{"core/demo-api": "5c6b7"},
+			expectedFailure:  true,
+		},
+		{
+			name: "rollout not seen before",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := getRolloutFailure([]model.RolloutStatus{aborted}, tt.imageDeployed, tt.initialPodHashes)
+			if (err != nil) != tt.expectedFailure {
+				t.Errorf("getRolloutFailure() error = '%v', expected failure %t", err, tt.expectedFailure)
+			}
+		})
+	}
+}
+
+func TestGetRolloutsWithoutImage(t *testing.T) {
+	rollout := newRollout(map[string]any{"phase": "Healthy"})
+	rollout.Object["spec"].(map[string]any)["template"] = map[string]any{
+		"spec": map[string]any{
+			"containers": []any{map[string]any{"name": "demo-api", "image": "ghcr.io/3lvia/core-demo-api:dev@" + previousDigest}},
+		},
+	}
+
+	client := newWorkloadClient(rollout)
+
+	rollouts := getRollouts(
+		context.Background(),
+		func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return client, nil },
+		newRolloutApplication("Healthy"),
+		workloadImage,
+	)
+	if len(rollouts) != 0 {
+		t.Errorf("getRollouts() = %v, expected rollouts of other images to be ignored", rollouts)
+	}
+}
+
+func TestWatchApplicationLifecyclePausedRollout(t *testing.T) {
+	tests := []struct {
+		name                string
+		acceptPausedRollout bool
+		expectedErr         error
+	}{
+		{name: "paused rollout accepted", acceptPausedRollout: true},
+		{name: "paused rollout not accepted", expectedErr: errApplicationTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			application := newRolloutApplication("Suspended")
+
+			client := newFakeDynamicClient(application)
+			client.PrependWatchReactor("applications", func(action k8stesting.Action) (bool, watch.Interface, error) {
+				w := watch.NewRaceFreeFake()
+				w.Add(application.DeepCopy())
+
+				return true, w, nil
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			var lastStatus model.ApplicationStatus
+			_, err := watchApplicationLifecycle(
+				ctx,
+				newKubernetesBackend(client, "argocd"),
+				nil,
+				&model.ValidatedDeployment{Deployment: &model.Deployment{
+					ApplicationName:     "demo-api",
+					System:              "core",
+					Environment:         "dev",
+					ClusterType:         "aks",
+					Image:               workloadImage,
+					AcceptPausedRollout: tt.acceptPausedRollout,
+				}},
+				"argocd",
+				application.GetName(),
+				func(status model.ApplicationStatus) { lastStatus = status },
+			)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("watchApplicationLifecycle() error = '%v', expected '%v'", err, tt.expectedErr)
+			}
+
+			if lastStatus.Deployed != tt.acceptPausedRollout || len(lastStatus.Rollouts) != 1 {
+				t.Errorf("watchApplicationLifecycle() status = %+v, expected deployed %t with 1 rollout", lastStatus, tt.acceptPausedRollout)
+			}
+		})
+	}
+}
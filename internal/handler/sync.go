@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// How often the application is read while waiting for Argo CD to finish a requested refresh.
+var refreshPollInterval = time.Second
+
+// The annotation requesting a refresh, which Argo CD removes once it has refreshed the application.
+const refreshAnnotation = "argocd.argoproj.io/refresh"
+
+// Requests a hard refresh and/or a sync of the application before it is watched,
+// so that we do not have to wait for Argo CD to poll the repository.
+// When both are requested, the sync is only started once the refresh has finished, so that it includes the latest commit.
+// The caller must have been authorized for the actions, see 'model.Deployment.Actions'.
+func triggerApplication(
+	ctx context.Context,
+	client dynamic.Interface,
+	gvr schema.GroupVersionResource,
+	namespace string,
+	application *unstructured.Unstructured,
+	deployment *model.Deployment,
+) error {
+	log_ := log.WithFields(log.Fields{
+		"application": application.GetName(),
+		"namespace":   namespace,
+	})
+
+	if deployment.Refresh {
+		patch := map[string]any{
+			"metadata": map[string]any{
+				"annotations": map[string]any{
+					refreshAnnotation: "hard",
+				},
+			},
+		}
+
+		refreshedAt := time.Now()
+
+		if err := patchApplication(ctx, client, gvr, namespace, application.GetName(), patch); err != nil {
+			return fmt.Errorf("failed to refresh application: %w", err)
+		}
+
+		log_.Info("Requested hard refresh of application")
+
+		if deployment.TriggerSync {
+			if err := waitForRefresh(ctx, client, gvr, namespace, application.GetName(), refreshedAt); err != nil {
+				return fmt.Errorf("failed to wait for refresh of application: %w", err)
+			}
+
+			log_.Info("Application was refreshed")
+		}
+	}
+
+	if deployment.TriggerSync {
+		// Argo CD does not queue operations, and overwriting a running one would abort it.
+		if _, found, _ := unstructured.NestedMap(application.Object, "operation"); found {
+			log_.Info("Application already has an operation in progress, not triggering sync")
+
+			return nil
+		}
+
+		patch := map[string]any{
+			"operation": map[string]any{
+				"initiatedBy": map[string]any{
+					"username": "deployvia",
+				},
+				"info": []any{
+					map[string]any{
+						"name":  "reason",
+						"value": fmt.Sprintf("deployment of %s", deployment.Image),
+					},
+				},
+				"sync": map[string]any{
+					"syncStrategy": map[string]any{
+						"hook": map[string]any{},
+					},
+				},
+			},
+		}
+
+		if err := patchApplication(ctx, client, gvr, namespace, application.GetName(), patch); err != nil {
+			return fmt.Errorf("failed to trigger sync of application: %w", err)
+		}
+
+		log_.Info("Triggered sync of application")
+	}
+
+	return nil
+}
+
+// Waits until Argo CD has removed the refresh annotation, or reconciled the application after the refresh was requested.
+// 'status.reconciledAt' only has a precision of seconds, so a reconciliation in the same second as the request is not counted.
+func waitForRefresh(
+	ctx context.Context,
+	client dynamic.Interface,
+	gvr schema.GroupVersionResource,
+	namespace string,
+	name string,
+	refreshedAt time.Time,
+) error {
+	ticker := time.NewTicker(refreshPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		application, err := client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			log.Warnf("Failed to get application %s while waiting for refresh: %v", name, err)
+			continue
+		}
+
+		if _, found := application.GetAnnotations()[refreshAnnotation]; !found {
+			return nil
+		}
+
+		reconciledAt, _, _ := unstructured.NestedString(application.Object, "status", "reconciledAt")
+		if t, err := time.Parse(time.RFC3339, reconciledAt); err == nil && t.After(refreshedAt.Truncate(time.Second)) {
+			return nil
+		}
+	}
+}
+
+func patchApplication(
+	ctx context.Context,
+	client dynamic.Interface,
+	gvr schema.GroupVersionResource,
+	namespace string,
+	name string,
+	patch map[string]any,
+) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal patch: %w", err)
+	}
+
+	_, err = client.Resource(gvr).Namespace(namespace).Patch(
+		ctx,
+		name,
+		types.MergePatchType,
+		data,
+		metav1.PatchOptions{FieldManager: "deployvia"},
+	)
+
+	return err
+}
@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/model"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var (
+	applicationGVR = schema.GroupVersionResource{
+		Group:    "argoproj.io",
+		Version:  "v1alpha1",
+		Resource: "applications",
+	}
+	applicationSetGVR = applicationGVR.GroupVersion().WithResource("applicationsets")
+)
+
+func newApplication(name string, operation map[string]any) *unstructured.Unstructured {
+	application := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": "argocd",
+		},
+	}}
+
+	if operation != nil {
+		application.Object["operation"] = operation
+	}
+
+	return application
+}
+
+func newFakeDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			applicationGVR:    "ApplicationList",
+			applicationSetGVR: "ApplicationSetList",
+		},
+		objects...,
+	)
+}
+
+// Returns the backend reading applications in the namespace of the fake cluster.
+func newKubernetesBackend(client *dynamicfake.FakeDynamicClient, namespace string) *backend.Kubernetes {
+	return backend.NewKubernetes(client.Resource(applicationGVR).Namespace(namespace))
+}
+
+// Makes reads of the application return it as Argo CD does once it has refreshed it, without the refresh annotation.
+func addRefreshReactor(client *dynamicfake.FakeDynamicClient) {
+	client.PrependReactor("get", "applications", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		obj, err := client.Tracker().Get(applicationGVR, action.GetNamespace(), action.(k8stesting.GetAction).GetName())
+		if err != nil {
+			return true, nil, err
+		}
+
+		application := obj.(*unstructured.Unstructured).DeepCopy()
+		unstructured.RemoveNestedField(application.Object, "metadata", "annotations", refreshAnnotation)
+
+		return true, application, nil
+	})
+}
+
+func TestTriggerApplication(t *testing.T) {
+	defer func(interval time.Duration) { refreshPollInterval = interval }(refreshPollInterval)
+	refreshPollInterval = 10 * time.Millisecond
+
+	runningOperation := map[string]any{
+		"initiatedBy": map[string]any{"automated": true},
+		"sync":        map[string]any{"revision": "abc"},
+	}
+
+	tests := []struct {
+		name                string
+		deployment          *model.Deployment
+		operation           map[string]any
+		expectRefresh       bool
+		expectedInitiatedBy string
+	}{
+		{
+			name:       "no actions",
+			deployment: &model.Deployment{},
+		},
+		{
+			name:          "refresh",
+			deployment:    &model.Deployment{Refresh: true},
+			expectRefresh: true,
+		},
+		{
+			name:                "refresh and sync",
+			deployment:          &model.Deployment{Refresh: true, TriggerSync: true},
+			expectRefresh:       true,
+			expectedInitiatedBy: "deployvia",
+		},
+		{
+			name:       "sync with operation in progress",
+			deployment: &model.Deployment{TriggerSync: true},
+			operation:  runningOperation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			application := newApplication("core-demo-api-dev", tt.operation)
+			client := newFakeDynamicClient(application)
+			addRefreshReactor(client)
+
+			err := triggerApplication(ctx, client, applicationGVR, "argocd", application, tt.deployment)
+			if err != nil {
+				t.Fatalf("triggerApplication() error = '%v'", err)
+			}
+
+			obj, err := client.Tracker().Get(applicationGVR, "argocd", "core-demo-api-dev")
+			if err != nil {
+				t.Fatalf("Failed to get application: %v", err)
+			}
+
+			patched := obj.(*unstructured.Unstructured)
+
+			if refresh := patched.GetAnnotations()["argocd.argoproj.io/refresh"] == "hard"; refresh != tt.expectRefresh {
+				t.Errorf("triggerApplication() refresh = %v, expected %v", refresh, tt.expectRefresh)
+			}
+
+			initiatedBy, _, _ := unstructured.NestedString(patched.Object, "operation", "initiatedBy", "username")
+			if initiatedBy != tt.expectedInitiatedBy {
+				t.Errorf("triggerApplication() operation initiated by '%s', expected '%s'", initiatedBy, tt.expectedInitiatedBy)
+			}
+		})
+	}
+}
+
+func TestTriggerApplicationWaitsForRefresh(t *testing.T) {
+	defer func(interval time.Duration) { refreshPollInterval = interval }(refreshPollInterval)
+	refreshPollInterval = 10 * time.Millisecond
+
+	deployment := &model.Deployment{Refresh: true, TriggerSync: true}
+
+	t.Run("sync after refresh", func(t *testing.T) {
+		application := newApplication("core-demo-api-dev", nil)
+		client := newFakeDynamicClient(application)
+
+		// Argo CD reconciles the application after the first read.
+		gets := 0
+		client.PrependReactor("get", "applications", func(k8stesting.Action) (bool, runtime.Object, error) {
+			gets++
+			if gets < 2 {
+				return false, nil, nil
+			}
+
+			refreshed := application.DeepCopy()
+			refreshed.SetAnnotations(map[string]string{refreshAnnotation: "hard"})
+			refreshed.Object["status"] = map[string]any{"reconciledAt": time.Now().Add(time.Second).UTC().Format(time.RFC3339)}
+
+			return true, refreshed, nil
+		})
+
+		if err := triggerApplication(context.Background(), client, applicationGVR, "argocd", application, deployment); err != nil {
+			t.Fatalf("triggerApplication() error = '%v'", err)
+		}
+
+		var verbs []string
+		for _, action := range client.Actions() {
+			verbs = append(verbs, action.GetVerb())
+		}
+
+		if expected := []string{"patch", "get", "get", "patch"}; !slices.Equal(verbs, expected) {
+			t.Errorf("triggerApplication() actions = %v, expected %v", verbs, expected)
+		}
+	})
+
+	t.Run("refresh does not finish", func(t *testing.T) {
+		application := newApplication("core-demo-api-dev", nil)
+		client := newFakeDynamicClient(application)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := triggerApplication(ctx, client, applicationGVR, "argocd", application, deployment); err == nil {
+			t.Fatal("triggerApplication() returned no error, expected the deadline to pass while waiting for the refresh")
+		}
+
+		obj, _ := client.Tracker().Get(applicationGVR, "argocd", "core-demo-api-dev")
+		if _, found, _ := unstructured.NestedMap(obj.(*unstructured.Unstructured).Object, "operation"); found {
+			t.Error("triggerApplication() started a sync before the refresh finished")
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var defaultWatchBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    10,
+	Cap:      30 * time.Second,
+}
+
+// retryApplicationClient resumes watches that are closed by the API server, e.g. because of watch timeouts or etcd compaction,
+// so that watches only end when the caller stops them.
+type retryApplicationClient struct {
+	backend.StatusBackend
+	backoff wait.Backoff
+	// Called every time a watch has to be re-established.
+	onReconnect func(ctx context.Context)
+}
+
+func (c *retryApplicationClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.AllowWatchBookmarks = true
+
+	// The first watch fails fast, so that e.g. missing permissions are reported instead of retried.
+	w, err := c.StatusBackend.Watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	rw := &retryWatcher{
+		client:      c.StatusBackend,
+		opts:        opts,
+		backoff:     c.backoff,
+		onReconnect: c.onReconnect,
+		result:      make(chan watch.Event),
+		cancel:      cancel,
+	}
+
+	go rw.run(ctx, w)
+
+	return rw, nil
+}
+
+// retryWatcher re-watches from the last seen resourceVersion with backoff,
+// and from the current state if that resourceVersion is too old (410 Gone).
+type retryWatcher struct {
+	client      backend.StatusBackend
+	opts        metav1.ListOptions
+	backoff     wait.Backoff
+	onReconnect func(ctx context.Context)
+	result      chan watch.Event
+	cancel      context.CancelFunc
+}
+
+func (rw *retryWatcher) ResultChan() <-chan watch.Event {
+	return rw.result
+}
+
+func (rw *retryWatcher) Stop() {
+	rw.cancel()
+}
+
+func (rw *retryWatcher) run(ctx context.Context, w watch.Interface) {
+	defer close(rw.result)
+
+	backoff := rw.backoff
+
+	for {
+		received, err := rw.consume(ctx, w)
+		w.Stop()
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			log.Infof("Watch resourceVersion %s is too old, watching from the current state", rw.opts.ResourceVersion)
+			rw.opts.ResourceVersion = ""
+		case err != nil:
+			log.Warnf("Watch failed: %v", err)
+		}
+
+		if received {
+			backoff = rw.backoff
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff.Step()):
+			}
+
+			if rw.onReconnect != nil {
+				rw.onReconnect(ctx)
+			}
+
+			log.Infof("Resuming watch from resourceVersion '%s'", rw.opts.ResourceVersion)
+
+			w, err = rw.client.Watch(ctx, rw.opts)
+			if err == nil {
+				break
+			}
+
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				rw.opts.ResourceVersion = ""
+			}
+
+			log.Warnf("Failed to resume watch: %v", err)
+		}
+	}
+}
+
+// Forwards events until the watch is closed, returning whether any events were received,
+// and the error reported by the API server, if any.
+func (rw *retryWatcher) consume(ctx context.Context, w watch.Interface) (bool, error) {
+	received := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return received, nil
+		case evt, ok := <-w.ResultChan():
+			if !ok {
+				return received, nil
+			}
+
+			if evt.Type == watch.Error {
+				return received, apierrors.FromObject(evt.Object)
+			}
+
+			received = true
+
+			if accessor, err := meta.Accessor(evt.Object); err == nil {
+				rw.opts.ResourceVersion = accessor.GetResourceVersion()
+			}
+
+			if evt.Type == watch.Bookmark {
+				continue
+			}
+
+			select {
+			case rw.result <- evt:
+			case <-ctx.Done():
+				return received, nil
+			}
+		}
+	}
+}
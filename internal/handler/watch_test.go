@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRetryApplicationClientWatch(t *testing.T) {
+	withResourceVersion := func(resourceVersion string) *unstructured.Unstructured {
+		application := newApplication("core-demo-api-dev", nil)
+		application.SetResourceVersion(resourceVersion)
+
+		return application
+	}
+
+	// Each watch is closed by the "API server" in a different way.
+	watches := []func(w *watch.FakeWatcher){
+		func(w *watch.FakeWatcher) {
+			w.Modify(withResourceVersion("1"))
+			w.Stop()
+		},
+		func(w *watch.FakeWatcher) {
+			w.Action(watch.Bookmark, withResourceVersion("2"))
+			w.Error(&metav1.Status{
+				Status: metav1.StatusFailure,
+				Code:   http.StatusGone,
+				Reason: metav1.StatusReasonExpired,
+			})
+		},
+		func(w *watch.FakeWatcher) {
+			w.Modify(withResourceVersion("3"))
+		},
+	}
+
+	var resourceVersions []string
+
+	client := newFakeDynamicClient()
+	client.PrependWatchReactor("applications", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		i := len(resourceVersions)
+		resourceVersions = append(resourceVersions, action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion)
+
+		w := watch.NewFake()
+		if i < len(watches) {
+			go watches[i](w)
+		}
+
+		return true, w, nil
+	})
+
+	reconnects := 0
+	retryClient := &retryApplicationClient{
+		StatusBackend: newKubernetesBackend(client, "argocd"),
+		backoff:       wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 5},
+		onReconnect: func(context.Context) {
+			reconnects++
+		},
+	}
+
+	w, err := retryClient.Watch(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = '%v'", err)
+	}
+
+	defer w.Stop()
+
+	var receivedResourceVersions []string
+	for len(receivedResourceVersions) < 2 {
+		select {
+		case evt, ok := <-w.ResultChan():
+			if !ok {
+				t.Fatalf("Watch() was closed, expected it to be resumed")
+			}
+
+			if evt.Type == watch.Bookmark || evt.Type == watch.Error {
+				t.Fatalf("Watch() forwarded %s event", evt.Type)
+			}
+
+			receivedResourceVersions = append(
+				receivedResourceVersions,
+				evt.Object.(*unstructured.Unstructured).GetResourceVersion(),
+			)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for watch event, received %v", receivedResourceVersions)
+		}
+	}
+
+	if receivedResourceVersions[0] != "1" || receivedResourceVersions[1] != "3" {
+		t.Errorf("Watch() sent resourceVersions %v, expected [1 3]", receivedResourceVersions)
+	}
+
+	// Resumed from the last event after the watch was closed, and from the current state after 410 Gone.
+	expectedResourceVersions := []string{"", "1", ""}
+	for i, expected := range expectedResourceVersions {
+		if resourceVersions[i] != expected {
+			t.Errorf("Watch %d started from resourceVersion '%s', expected '%s'", i, resourceVersions[i], expected)
+		}
+	}
+
+	if reconnects != 2 {
+		t.Errorf("Watch() reconnected %d times, expected 2", reconnects)
+	}
+}
+
+func TestRetryApplicationClientStop(t *testing.T) {
+	client := newFakeDynamicClient()
+	client.PrependWatchReactor("applications", func(k8stesting.Action) (bool, watch.Interface, error) {
+		return true, watch.NewFake(), nil
+	})
+
+	retryClient := &retryApplicationClient{
+		StatusBackend: newKubernetesBackend(client, "argocd"),
+		backoff:       defaultWatchBackoff,
+	}
+
+	w, err := retryClient.Watch(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("Watch() error = '%v'", err)
+	}
+
+	w.Stop()
+
+	select {
+	case _, ok := <-w.ResultChan():
+		if ok {
+			t.Errorf("Watch() sent an event after Stop()")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Watch() was not closed after Stop()")
+	}
+}
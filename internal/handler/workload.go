@@ -0,0 +1,383 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/config"
+	"github.com/3lvia/deployvia/internal/model"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	statefulSetGVR = schema.GroupVersionResource{
+		Group:    "apps",
+		Version:  "v1",
+		Resource: "statefulsets",
+	}
+	replicaSetGVR = schema.GroupVersionResource{
+		Group:    "apps",
+		Version:  "v1",
+		Resource: "replicasets",
+	}
+	rolloutGVR = schema.GroupVersionResource{
+		Group:    "argoproj.io",
+		Version:  "v1alpha1",
+		Resource: "rollouts",
+	}
+	podGVR = schema.GroupVersionResource{
+		Version:  "v1",
+		Resource: "pods",
+	}
+)
+
+// The workloads that are verified, keyed by '<group>/<kind>' as in 'status.resources'.
+var workloadGVRs = map[string]schema.GroupVersionResource{
+	"apps/Deployment":     backend.DeploymentGVR,
+	"apps/StatefulSet":    statefulSetGVR,
+	"argoproj.io/Rollout": rolloutGVR,
+}
+
+// How often workloads and rollouts are checked again while they roll out,
+// since the pods being replaced or a rollout moving to the next step does not change the application.
+var workloadRecheckInterval = 5 * time.Second
+
+// The revision of a Deployment, which is copied to the ReplicaSet of its current pod template.
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// workloadClients returns the clients for the cluster an application is deployed to, nil if deployvia has no access to it.
+type workloadClients func(application *unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface)
+
+func getWorkloadClients(cluster *config.Cluster) workloadClients {
+	return func(application *unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) {
+		server, _, _ := unstructured.NestedString(application.Object, "spec", "destination", "server")
+		name, _, _ := unstructured.NestedString(application.Object, "spec", "destination", "name")
+
+		return cluster.WorkloadClients(server, name)
+	}
+}
+
+// Verifies the rollout of the Deployments, StatefulSets and Rollouts in 'status.resources' that run the image,
+// in the cluster the application is deployed to. Workloads running other images, e.g. a database, are ignored.
+// Workloads that can not be read are reported as not verified, so that they are checked again instead of failing the deployment.
+func verifyWorkloads(
+	ctx context.Context,
+	workloadClients workloadClients,
+	application *unstructured.Unstructured,
+	image string,
+) ([]model.WorkloadStatus, error) {
+	var client dynamic.Interface
+	if workloadClients != nil {
+		client, _ = workloadClients(application)
+	}
+
+	if client == nil {
+		return nil, &model.WatchFailedError{
+			Err: fmt.Errorf("no access to the cluster application %s is deployed to", application.GetName()),
+		}
+	}
+
+	var workloads []model.WorkloadStatus
+	for _, resource := range backend.GetApplicationResources(application) {
+		gvr, ok := workloadGVRs[resource.Group+"/"+resource.Kind]
+		if !ok {
+			continue
+		}
+
+		workload, err := client.Resource(gvr).Namespace(resource.Namespace).Get(ctx, resource.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			log.Warnf("Failed to get %s %s/%s: %v", resource.Kind, resource.Namespace, resource.Name, err)
+
+			workloads = append(workloads, model.WorkloadStatus{
+				Kind:      resource.Kind,
+				Namespace: resource.Namespace,
+				Name:      resource.Name,
+				Message:   fmt.Sprintf("failed to get %s: %v", strings.ToLower(resource.Kind), err),
+			})
+
+			continue
+		}
+
+		containerNames := getContainersRunningImage(workload, image)
+		if len(containerNames) == 0 {
+			continue
+		}
+
+		workloadStatus, err := verifyWorkload(ctx, client, workload, image, containerNames)
+		if err != nil {
+			log.Warnf("Failed to verify %s %s/%s: %v", resource.Kind, resource.Namespace, resource.Name, err)
+
+			workloadStatus.Verified = false
+			workloadStatus.Message = err.Error()
+		}
+
+		workloads = append(workloads, workloadStatus)
+	}
+
+	if len(workloads) == 0 {
+		return nil, &model.WorkloadNotFoundError{Image: image}
+	}
+
+	return workloads, nil
+}
+
+// Returns whether every workload is verified.
+func workloadsVerified(workloads []model.WorkloadStatus) bool {
+	return !slices.ContainsFunc(workloads, func(workload model.WorkloadStatus) bool {
+		return !workload.Verified
+	})
+}
+
+// Verifies that the latest generation of the workload is observed, that all replicas are updated and available,
+// and that every running or pending pod of the current revision runs the image.
+// Pods of previous revisions and pods that have completed, failed or been evicted are not counted.
+func verifyWorkload(
+	ctx context.Context,
+	client dynamic.Interface,
+	workload *unstructured.Unstructured,
+	image string,
+	containerNames []string,
+) (model.WorkloadStatus, error) {
+	workloadStatus := model.WorkloadStatus{
+		Kind:      workload.GetKind(),
+		Namespace: workload.GetNamespace(),
+		Name:      workload.GetName(),
+	}
+
+	workloadStatus.GenerationObserved = getObservedGeneration(workload) >= workload.GetGeneration()
+
+	replicas, found, _ := unstructured.NestedInt64(workload.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+
+	workloadStatus.Replicas = replicas
+	workloadStatus.UpdatedReplicas, _, _ = unstructured.NestedInt64(workload.Object, "status", "updatedReplicas")
+	workloadStatus.AvailableReplicas, _, _ = unstructured.NestedInt64(workload.Object, "status", "availableReplicas")
+
+	revisionLabel, revision, err := getCurrentRevision(ctx, client, workload)
+	if err != nil {
+		return workloadStatus, err
+	}
+
+	var pods []unstructured.Unstructured
+	if revision != "" {
+		requirement, err := labels.NewRequirement(revisionLabel, selection.Equals, []string{revision})
+		if err != nil {
+			return workloadStatus, fmt.Errorf("invalid revision %s: %w", revision, err)
+		}
+
+		pods, err = getWorkloadPods(ctx, client, workload, *requirement)
+		if err != nil {
+			return workloadStatus, err
+		}
+	}
+
+	for _, pod := range pods {
+		phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+		if pod.GetDeletionTimestamp() != nil || (phase != "Running" && phase != "Pending") {
+			continue
+		}
+
+		workloadStatus.Pods++
+
+		if podRunsImage(&pod, containerNames, image) {
+			workloadStatus.PodsWithImage++
+		}
+	}
+
+	switch {
+	case !workloadStatus.GenerationObserved:
+		workloadStatus.Message = fmt.Sprintf("waiting for generation %d to be observed", workload.GetGeneration())
+	case workloadStatus.UpdatedReplicas < replicas:
+		workloadStatus.Message = fmt.Sprintf("%d of %d replicas updated", workloadStatus.UpdatedReplicas, replicas)
+	case workloadStatus.AvailableReplicas < replicas:
+		workloadStatus.Message = fmt.Sprintf("%d of %d replicas available", workloadStatus.AvailableReplicas, replicas)
+	case revision == "":
+		workloadStatus.Message = "waiting for the current revision to be created"
+	case int64(workloadStatus.Pods) != replicas:
+		workloadStatus.Message = fmt.Sprintf("%d pods running, expected %d", workloadStatus.Pods, replicas)
+	case workloadStatus.PodsWithImage < workloadStatus.Pods:
+		workloadStatus.Message = fmt.Sprintf("%d of %d pods run the image", workloadStatus.PodsWithImage, workloadStatus.Pods)
+	default:
+		workloadStatus.Verified = true
+	}
+
+	return workloadStatus, nil
+}
+
+// Returns the pods matching the selector of the workload and the additional requirements.
+func getWorkloadPods(
+	ctx context.Context,
+	client dynamic.Interface,
+	workload *unstructured.Unstructured,
+	requirements ...labels.Requirement,
+) ([]unstructured.Unstructured, error) {
+	selector, err := getWorkloadSelector(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := client.Resource(podGVR).Namespace(workload.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.Add(requirements...).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	return pods.Items, nil
+}
+
+func getWorkloadSelector(workload *unstructured.Unstructured) (labels.Selector, error) {
+	selectorMap, _, _ := unstructured.NestedMap(workload.Object, "spec", "selector")
+
+	var labelSelector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorMap, &labelSelector); err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	return selector, nil
+}
+
+// Returns the label and value identifying the pods of the current revision of the workload, an empty value if it is not created yet:
+//   - the 'pod-template-hash' of the ReplicaSet of a Deployment with the revision of the Deployment,
+//   - the 'controller-revision-hash' of the update revision of a StatefulSet,
+//   - and the 'rollouts-pod-template-hash' of the current pod hash of a Rollout.
+func getCurrentRevision(ctx context.Context, client dynamic.Interface, workload *unstructured.Unstructured) (string, string, error) {
+	switch workload.GetKind() {
+	case "StatefulSet":
+		updateRevision, _, _ := unstructured.NestedString(workload.Object, "status", "updateRevision")
+		return "controller-revision-hash", updateRevision, nil
+	case "Rollout":
+		currentPodHash, _, _ := unstructured.NestedString(workload.Object, "status", "currentPodHash")
+		return "rollouts-pod-template-hash", currentPodHash, nil
+	}
+
+	replicaSets, err := getOwnedReplicaSets(ctx, client, workload)
+	if err != nil {
+		return "", "", err
+	}
+
+	revision := workload.GetAnnotations()[deploymentRevisionAnnotation]
+	for _, replicaSet := range replicaSets {
+		if replicaSet.GetAnnotations()[deploymentRevisionAnnotation] == revision {
+			return "pod-template-hash", replicaSet.GetLabels()["pod-template-hash"], nil
+		}
+	}
+
+	return "pod-template-hash", "", nil
+}
+
+// Returns the ReplicaSets controlled by the workload.
+func getOwnedReplicaSets(ctx context.Context, client dynamic.Interface, workload *unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	selector, err := getWorkloadSelector(workload)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets, err := client.Resource(replicaSetGVR).Namespace(workload.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets: %w", err)
+	}
+
+	return slices.DeleteFunc(replicaSets.Items, func(replicaSet unstructured.Unstructured) bool {
+		return !metav1.IsControlledBy(&replicaSet, workload)
+	}), nil
+}
+
+// Returns 'status.observedGeneration', which Rollouts report as a string.
+func getObservedGeneration(workload *unstructured.Unstructured) int64 {
+	observedGeneration, _, _ := unstructured.NestedFieldNoCopy(workload.Object, "status", "observedGeneration")
+
+	switch observedGeneration := observedGeneration.(type) {
+	case int64:
+		return observedGeneration
+	case float64:
+		return int64(observedGeneration)
+	case string:
+		generation, _ := strconv.ParseInt(observedGeneration, 10, 64)
+		return generation
+	default:
+		return 0
+	}
+}
+
+// Returns the names of the containers in the pod template of the workload that run the image.
+func getContainersRunningImage(workload *unstructured.Unstructured, image string) []string {
+	containers, _, _ := unstructured.NestedSlice(workload.Object, "spec", "template", "spec", "containers")
+
+	var containerNames []string
+	for _, container := range containers {
+		containerMap, ok := container.(map[string]any)
+		if !ok || containerMap["image"] != image {
+			continue
+		}
+
+		if name, ok := containerMap["name"].(string); ok {
+			containerNames = append(containerNames, name)
+		}
+	}
+
+	return containerNames
+}
+
+// Returns whether the containers of the pod run the image, comparing the digest of the image with the 'imageID' of the containers,
+// or the image itself if it has no digest.
+func podRunsImage(pod *unstructured.Unstructured, containerNames []string, image string) bool {
+	_, digest, hasDigest := strings.Cut(image, "@")
+
+	containerStatuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "containerStatuses")
+
+	matched := 0
+	for _, containerStatus := range containerStatuses {
+		containerStatusMap, ok := containerStatus.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		if name, _ := containerStatusMap["name"].(string); !slices.Contains(containerNames, name) {
+			continue
+		}
+
+		imageID, _ := containerStatusMap["imageID"].(string)
+		statusImage, _ := containerStatusMap["image"].(string)
+
+		// The image ID is e.g. 'ghcr.io/3lvia/core-demo-api@sha256:...', with a 'docker-pullable://' prefix on older runtimes.
+		if hasDigest && !strings.HasSuffix(imageID, "@"+digest) && imageID != digest {
+			return false
+		}
+
+		if !hasDigest && statusImage != image && !strings.HasSuffix(statusImage, "/"+image) {
+			return false
+		}
+
+		matched++
+	}
+
+	return matched == len(containerNames)
+}
@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/3lvia/deployvia/internal/backend"
+	"github.com/3lvia/deployvia/internal/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	workloadImage   = "ghcr.io/3lvia/core-demo-api:dev@sha256:1234567890abcdef"
+	previousDigest  = "sha256:fedcba0987654321"
+	podTemplateHash = "7d9f8"
+)
+
+func newWorkloadClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			backend.DeploymentGVR: "DeploymentList",
+			replicaSetGVR:         "ReplicaSetList",
+			statefulSetGVR:        "StatefulSetList",
+			rolloutGVR:            "RolloutList",
+			analysisRunGVR:        "AnalysisRunList",
+			podGVR:                "PodList",
+			eventGVR:              "EventList",
+		},
+		objects...,
+	)
+}
+
+func newWorkloadApplication() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]any{"name": "core-demo-api-dev-aks", "namespace": "argocd"},
+		"spec": map[string]any{
+			"destination": map[string]any{"server": "https://kubernetes.default.svc"},
+		},
+		"status": map[string]any{
+			"resources": []any{
+				map[string]any{"group": "apps", "kind": "Deployment", "namespace": "core", "name": "demo-api"},
+				map[string]any{"kind": "Service", "namespace": "core", "name": "demo-api"},
+			},
+		},
+	}}
+}
+
+func newWorkloadDeployment(image string, updatedReplicas int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":        "demo-api",
+			"namespace":   "core",
+			"uid":         "demo-api-uid",
+			"generation":  int64(3),
+			"annotations": map[string]any{deploymentRevisionAnnotation: "3"},
+		},
+		"spec": map[string]any{
+			"replicas": int64(2),
+			"selector": map[string]any{"matchLabels": map[string]any{"app": "demo-api"}},
+			"template": map[string]any{
+				"spec": map[string]any{
+					"containers": []any{
+						map[string]any{"name": "demo-api", "image": image},
+						map[string]any{"name": "proxy", "image": "envoyproxy/envoy:v1.30"},
+					},
+				},
+			},
+		},
+		"status": map[string]any{
+			"observedGeneration": int64(3),
+			"updatedReplicas":    updatedReplicas,
+			"availableReplicas":  updatedReplicas,
+		},
+	}}
+}
+
+func newWorkloadReplicaSet(hash string, revision string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "ReplicaSet",
+		"metadata": map[string]any{
+			"name":        "demo-api-" + hash,
+			"namespace":   "core",
+			"uid":         "demo-api-" + hash + "-uid",
+			"labels":      map[string]any{"app": "demo-api", "pod-template-hash": hash},
+			"annotations": map[string]any{deploymentRevisionAnnotation: revision},
+			"ownerReferences": []any{
+				map[string]any{
+					"apiVersion": "apps/v1",
+					"kind":       "Deployment",
+					"name":       "demo-api",
+					"uid":        "demo-api-uid",
+					"controller": true,
+				},
+			},
+		},
+		"spec": map[string]any{"replicas": int64(2)},
+	}}
+}
+
+func newWorkloadPod(name string, digest string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": "core",
+			"labels":    map[string]any{"app": "demo-api", "pod-template-hash": podTemplateHash},
+		},
+		"status": map[string]any{
+			"phase": "Running",
+			"containerStatuses": []any{
+				map[string]any{
+					"name":    "demo-api",
+					"image":   "ghcr.io/3lvia/core-demo-api:dev",
+					"imageID": "docker-pullable://ghcr.io/3lvia/core-demo-api@" + digest,
+				},
+				map[string]any{
+					"name":    "proxy",
+					"image":   "envoyproxy/envoy:v1.30",
+					"imageID": "docker.io/envoyproxy/envoy@sha256:0000",
+				},
+			},
+		},
+	}}
+}
+
+func TestVerifyWorkloads(t *testing.T) {
+	digest := "sha256:1234567890abcdef"
+
+	tests := []struct {
+		name             string
+		objects          []runtime.Object
+		expectedVerified bool
+		expectedMessage  string
+	}{
+		{
+			name: "rolled out",
+			objects: []runtime.Object{
+				newWorkloadDeployment(workloadImage, 2),
+				newWorkloadReplicaSet(podTemplateHash, "3"),
+				newWorkloadPod("demo-api-1", digest),
+				newWorkloadPod("demo-api-2", digest),
+			},
+			expectedVerified: true,
+		},
+		{
+			name: "replicas not updated",
+			objects: []runtime.Object{
+				newWorkloadDeployment(workloadImage, 1),
+				newWorkloadReplicaSet(podTemplateHash, "3"),
+				newWorkloadPod("demo-api-1", digest),
+				newWorkloadPod("demo-api-2", previousDigest),
+			},
+			expectedMessage: "1 of 2 replicas updated",
+		},
+		{
+			name: "pods of previous revisions and finished pods ignored",
+			objects: []runtime.Object{
+				newWorkloadDeployment(workloadImage, 2),
+				newWorkloadReplicaSet("5c6b7", "2"),
+				newWorkloadReplicaSet(podTemplateHash, "3"),
+				newWorkloadPod("demo-api-1", digest),
+				newWorkloadPod("demo-api-2", digest),
+				withPodTemplateHash(newWorkloadPod("demo-api-0", previousDigest), "5c6b7"),
+				withPodPhase(newWorkloadPod("demo-api-3", digest), "Failed"),
+				withPodPhase(newWorkloadPod("demo-api-4", digest), "Succeeded"),
+			},
+			expectedVerified: true,
+		},
+		{
+			name: "surge pod still running",
+			objects: []runtime.Object{
+				newWorkloadDeployment(workloadImage, 2),
+				newWorkloadReplicaSet(podTemplateHash, "3"),
+				newWorkloadPod("demo-api-1", digest),
+				newWorkloadPod("demo-api-2", digest),
+				withPodPhase(newWorkloadPod("demo-api-3", digest), "Pending"),
+			},
+			expectedMessage: "3 pods running, expected 2",
+		},
+		{
+			name: "pod runs previous digest",
+			objects: []runtime.Object{
+				newWorkloadDeployment(workloadImage, 2),
+				newWorkloadReplicaSet(podTemplateHash, "3"),
+				newWorkloadPod("demo-api-1", digest),
+				newWorkloadPod("demo-api-2", previousDigest),
+			},
+			expectedMessage: "1 of 2 pods run the image",
+		},
+		{
+			name: "replica set of the revision not created",
+			objects: []runtime.Object{
+				newWorkloadDeployment(workloadImage, 2),
+				newWorkloadReplicaSet("5c6b7", "2"),
+				withPodTemplateHash(newWorkloadPod("demo-api-0", previousDigest), "5c6b7"),
+			},
+			expectedMessage: "waiting for the current revision to be created",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newWorkloadClient(tt.objects...)
+
+			workloads, err := verifyWorkloads(
+				context.Background(),
+				func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return client, nil },
+				newWorkloadApplication(),
+				workloadImage,
+			)
+			if err != nil {
+				t.Fatalf("verifyWorkloads() error = %v", err)
+			}
+
+			if len(workloads) != 1 {
+				t.Fatalf("verifyWorkloads() returned %d workloads, expected 1", len(workloads))
+			}
+
+			if workloads[0].Verified != tt.expectedVerified || workloads[0].Message != tt.expectedMessage {
+				t.Errorf(
+					"verifyWorkloads() = verified %t, '%s', expected verified %t, '%s'",
+					workloads[0].Verified,
+					workloads[0].Message,
+					tt.expectedVerified,
+					tt.expectedMessage,
+				)
+			}
+
+			if workloadsVerified(workloads) != tt.expectedVerified {
+				t.Errorf("workloadsVerified() = %t, expected %t", !tt.expectedVerified, tt.expectedVerified)
+			}
+		})
+	}
+}
+
+func withPodTemplateHash(pod *unstructured.Unstructured, hash string) *unstructured.Unstructured {
+	_ = unstructured.SetNestedField(pod.Object, hash, "metadata", "labels", "pod-template-hash")
+	return pod
+}
+
+func withPodPhase(pod *unstructured.Unstructured, phase string) *unstructured.Unstructured {
+	_ = unstructured.SetNestedField(pod.Object, phase, "status", "phase")
+	return pod
+}
+
+func TestVerifyWorkloadsTemporaryErrors(t *testing.T) {
+	client := newWorkloadClient(newWorkloadDeployment(workloadImage, 2))
+	client.PrependReactor("list", "replicasets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("etcd leader changed")
+	})
+
+	workloads, err := verifyWorkloads(
+		context.Background(),
+		func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return client, nil },
+		newWorkloadApplication(),
+		workloadImage,
+	)
+	if err != nil {
+		t.Fatalf("verifyWorkloads() error = %v, expected the workload to be checked again", err)
+	}
+
+	if len(workloads) != 1 || workloads[0].Verified || !strings.Contains(workloads[0].Message, "etcd leader changed") {
+		t.Errorf("verifyWorkloads() = %v, expected an unverified workload with the error", workloads)
+	}
+}
+
+func TestVerifyWorkloadsErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		workloadClients workloadClients
+		expectedProblem model.ProblemType
+	}{
+		{
+			name: "no workload runs the image",
+			workloadClients: func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) {
+				return newWorkloadClient(newWorkloadDeployment("ghcr.io/3lvia/core-demo-api:dev@sha256:fedcba0987654321", 2)), nil
+			},
+			expectedProblem: model.ProblemWorkloadNotFound,
+		},
+		{
+			name:            "no access to the destination",
+			workloadClients: func(*unstructured.Unstructured) (dynamic.Interface, kubernetes.Interface) { return nil, nil },
+			expectedProblem: model.ProblemWatchFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifyWorkloads(context.Background(), tt.workloadClients, newWorkloadApplication(), workloadImage)
+			if err == nil {
+				t.Fatal("verifyWorkloads() returned no error")
+			}
+
+			if problemType := model.GetProblemType(err); problemType.URI != tt.expectedProblem.URI {
+				t.Errorf("verifyWorkloads() error = '%v', expected problem type %s", err, tt.expectedProblem.URI)
+			}
+		})
+	}
+}
+
+func TestPodRunsImage(t *testing.T) {
+	pod := newWorkloadPod("demo-api-1", "sha256:1234567890abcdef")
+
+	tests := []struct {
+		name     string
+		image    string
+		expected bool
+	}{
+		{name: "same digest", image: workloadImage, expected: true},
+		{name: "other digest", image: "ghcr.io/3lvia/core-demo-api:dev@" + previousDigest},
+		{name: "same tag without digest", image: "ghcr.io/3lvia/core-demo-api:dev", expected: true},
+		{name: "other tag without digest", image: "ghcr.io/3lvia/core-demo-api:test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := podRunsImage(pod, []string{"demo-api"}, tt.image); actual != tt.expected {
+				t.Errorf("podRunsImage(%s) = %t, expected %t", tt.image, actual, tt.expected)
+			}
+		})
+	}
+}
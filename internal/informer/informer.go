@@ -0,0 +1,274 @@
+package informer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ApplicationInformer keeps a single shared cache of the Argo CD applications, or ApplicationSets, in a namespace,
+// so that requests do not have to list and watch the API server themselves.
+// List and Watch mirror 'dynamic.ResourceInterface', with watches fed from the cache.
+type ApplicationInformer struct {
+	resource  string
+	namespace string
+	informer  cache.SharedIndexInformer
+	lister    cache.GenericNamespaceLister
+
+	mu          sync.RWMutex
+	subscribers map[*subscription]struct{}
+}
+
+func New(client dynamic.Interface, gvr schema.GroupVersionResource, namespace string) (*ApplicationInformer, error) {
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, namespace, nil)
+	genericInformer := factory.ForResource(gvr)
+
+	i := &ApplicationInformer{
+		resource:    gvr.Resource,
+		namespace:   namespace,
+		informer:    genericInformer.Informer(),
+		lister:      genericInformer.Lister().ByNamespace(namespace),
+		subscribers: make(map[*subscription]struct{}),
+	}
+
+	_, err := i.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj any) {
+			i.notify(watch.Added, obj)
+		},
+		UpdateFunc: func(_ any, obj any) {
+			i.notify(watch.Modified, obj)
+		},
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+
+			i.notify(watch.Deleted, obj)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add event handler: %w", err)
+	}
+
+	return i, nil
+}
+
+// Run fills the cache and keeps it up to date until the context is cancelled.
+func (i *ApplicationInformer) Run(ctx context.Context) {
+	log.Infof("Starting %s informer for namespace %s", i.resource, i.namespace)
+
+	i.informer.Run(ctx.Done())
+}
+
+// HasSynced returns true once the cache has been filled, which the readiness probe depends on.
+func (i *ApplicationInformer) HasSynced() bool {
+	return i.informer.HasSynced()
+}
+
+func (i *ApplicationInformer) Namespace() string {
+	return i.namespace
+}
+
+// List returns the cached applications matching the label selector, waiting for the cache to sync first.
+func (i *ApplicationInformer) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	if !cache.WaitForCacheSync(ctx.Done(), i.HasSynced) {
+		return nil, fmt.Errorf("application cache has not synced")
+	}
+
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector: %w", err)
+	}
+
+	objects, err := i.lister.List(labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &unstructured.UnstructuredList{}
+	for _, object := range objects {
+		if obj, ok := object.(*unstructured.Unstructured); ok {
+			list.Items = append(list.Items, *obj.DeepCopy())
+		}
+	}
+
+	return list, nil
+}
+
+// Watch subscribes to changes of the cached applications matching the label and field selectors.
+// Like a watch against the API server, it starts with an 'ADDED' event for every matching application,
+// and is closed after 'TimeoutSeconds'.
+func (i *ApplicationInformer) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	if !cache.WaitForCacheSync(ctx.Done(), i.HasSynced) {
+		return nil, fmt.Errorf("application cache has not synced")
+	}
+
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid label selector: %w", err)
+	}
+
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector: %w", err)
+	}
+
+	s := newSubscription(func(obj *unstructured.Unstructured) bool {
+		return labelSelector.Matches(labels.Set(obj.GetLabels())) &&
+			fieldSelector.Matches(fields.Set{
+				"metadata.name":      obj.GetName(),
+				"metadata.namespace": obj.GetNamespace(),
+			})
+	})
+
+	i.mu.Lock()
+	i.subscribers[s] = struct{}{}
+	i.mu.Unlock()
+
+	s.remove = func() {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		delete(i.subscribers, s)
+	}
+
+	// Subscribing before reading the cache means that an update may be sent twice, but never missed.
+	objects, err := i.lister.List(labels.Everything())
+	if err != nil {
+		s.Stop()
+
+		return nil, err
+	}
+
+	for _, object := range objects {
+		if obj, ok := object.(*unstructured.Unstructured); ok && s.matches(obj) {
+			s.push(watch.Event{Type: watch.Added, Object: obj.DeepCopy()})
+		}
+	}
+
+	go func() {
+		var timeout <-chan time.Time
+		if opts.TimeoutSeconds != nil {
+			timeout = time.After(time.Duration(*opts.TimeoutSeconds) * time.Second)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-timeout:
+		case <-s.done:
+		}
+
+		s.Stop()
+	}()
+
+	return s, nil
+}
+
+func (i *ApplicationInformer) notify(eventType watch.EventType, object any) {
+	obj, ok := object.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for s := range i.subscribers {
+		if s.matches(obj) {
+			s.push(watch.Event{Type: eventType, Object: obj.DeepCopy()})
+		}
+	}
+}
+
+// subscription is a 'watch.Interface' fed by the informer.
+// Events are queued, so that a slow request never blocks the informer or other requests.
+type subscription struct {
+	matches func(obj *unstructured.Unstructured) bool
+	remove  func()
+
+	mu     sync.Mutex
+	queue  []watch.Event
+	signal chan struct{}
+
+	result   chan watch.Event
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newSubscription(matches func(obj *unstructured.Unstructured) bool) *subscription {
+	s := &subscription{
+		matches: matches,
+		signal:  make(chan struct{}, 1),
+		result:  make(chan watch.Event),
+		done:    make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+func (s *subscription) ResultChan() <-chan watch.Event {
+	return s.result
+}
+
+func (s *subscription) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+
+		if s.remove != nil {
+			s.remove()
+		}
+	})
+}
+
+func (s *subscription) push(event watch.Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscription) run() {
+	defer close(s.result)
+
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+
+			select {
+			case <-s.signal:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+
+		event := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.result <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
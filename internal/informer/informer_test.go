@@ -0,0 +1,157 @@
+package informer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var applicationGVR = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "applications",
+}
+
+func newApplication(name string, system string, healthStatus string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": "argocd",
+			"labels":    map[string]any{"elvia.no/system": system},
+		},
+		"status": map[string]any{
+			"health": map[string]any{"status": healthStatus},
+		},
+	}}
+}
+
+func nextEvent(t *testing.T, w watch.Interface) watch.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-w.ResultChan():
+		if !ok {
+			t.Fatalf("Watch closed unexpectedly")
+		}
+
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for watch event")
+	}
+
+	return watch.Event{}
+}
+
+func TestApplicationInformer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{applicationGVR: "ApplicationList"},
+		newApplication("core-demo-api-dev", "core", "Progressing"),
+		newApplication("kunde-api-dev", "kunde", "Healthy"),
+	)
+
+	applicationInformer, err := New(client, applicationGVR, "argocd")
+	if err != nil {
+		t.Fatalf("New() error = '%v'", err)
+	}
+
+	go applicationInformer.Run(ctx)
+
+	applications, err := applicationInformer.List(ctx, metav1.ListOptions{LabelSelector: "elvia.no/system=core"})
+	if err != nil {
+		t.Fatalf("List() error = '%v'", err)
+	}
+
+	if len(applications.Items) != 1 || applications.Items[0].GetName() != "core-demo-api-dev" {
+		t.Fatalf("List() = %v, expected only core-demo-api-dev", applications.Items)
+	}
+
+	if !applicationInformer.HasSynced() {
+		t.Errorf("HasSynced() = false after List()")
+	}
+
+	w, err := applicationInformer.Watch(ctx, metav1.ListOptions{FieldSelector: "metadata.name=core-demo-api-dev"})
+	if err != nil {
+		t.Fatalf("Watch() error = '%v'", err)
+	}
+
+	if event := nextEvent(t, w); event.Type != watch.Added {
+		t.Errorf("Watch() first event = %s, expected %s", event.Type, watch.Added)
+	}
+
+	// Changes to other applications must not be sent to the watch.
+	for _, application := range []*unstructured.Unstructured{
+		newApplication("kunde-api-dev", "kunde", "Degraded"),
+		newApplication("core-demo-api-dev", "core", "Healthy"),
+	} {
+		if _, err := client.Resource(applicationGVR).Namespace("argocd").Update(
+			ctx,
+			application,
+			metav1.UpdateOptions{},
+		); err != nil {
+			t.Fatalf("Failed to update application: %v", err)
+		}
+	}
+
+	event := nextEvent(t, w)
+	obj := event.Object.(*unstructured.Unstructured)
+	healthStatus, _, _ := unstructured.NestedString(obj.Object, "status", "health", "status")
+	if event.Type != watch.Modified || obj.GetName() != "core-demo-api-dev" || healthStatus != "Healthy" {
+		t.Errorf("Watch() event = %s %s (%s), expected %s core-demo-api-dev (Healthy)", event.Type, obj.GetName(), healthStatus, watch.Modified)
+	}
+
+	w.Stop()
+
+	select {
+	case _, ok := <-w.ResultChan():
+		if ok {
+			t.Errorf("Watch() sent an event after Stop()")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Watch() was not closed after Stop()")
+	}
+}
+
+func TestApplicationInformerWatchTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{applicationGVR: "ApplicationList"},
+	)
+
+	applicationInformer, err := New(client, applicationGVR, "argocd")
+	if err != nil {
+		t.Fatalf("New() error = '%v'", err)
+	}
+
+	go applicationInformer.Run(ctx)
+
+	timeoutSeconds := int64(1)
+	w, err := applicationInformer.Watch(ctx, metav1.ListOptions{TimeoutSeconds: &timeoutSeconds})
+	if err != nil {
+		t.Fatalf("Watch() error = '%v'", err)
+	}
+
+	select {
+	case _, ok := <-w.ResultChan():
+		if ok {
+			t.Errorf("Watch() sent an event for an empty cache")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Watch() was not closed after TimeoutSeconds")
+	}
+}
@@ -0,0 +1,163 @@
+package job
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+type Job struct {
+	ID           string                             `json:"id"`
+	Status       Status                             `json:"status"`
+	Deployment   model.Deployment                   `json:"deployment"`
+	Applications map[string]model.ApplicationStatus `json:"applications"`
+	Error        string                             `json:"error,omitempty"`
+	Result       *model.DeploymentResult            `json:"result,omitempty"`
+	CreatedAt    time.Time                          `json:"created_at"`
+	FinishedAt   *time.Time                         `json:"finished_at,omitempty"`
+}
+
+// Registry keeps track of asynchronous deployment checks in memory.
+// Finished jobs are removed once they are older than the configured retention,
+// and at most 'maxRunning' jobs may run at once, since each of them watches applications until it finishes.
+type Registry struct {
+	mu         sync.RWMutex
+	jobs       map[string]*Job
+	retention  time.Duration
+	maxRunning int
+	running    int
+}
+
+func NewRegistry(retention time.Duration, maxRunning int) *Registry {
+	return &Registry{
+		jobs:       make(map[string]*Job),
+		retention:  retention,
+		maxRunning: maxRunning,
+	}
+}
+
+// Create registers a running job, or returns a 'TooManyJobsError' if the maximum number of jobs are already running.
+func (r *Registry) Create(deployment *model.Deployment) (Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running >= r.maxRunning {
+		return Job{}, &model.TooManyJobsError{MaxRunning: r.maxRunning}
+	}
+
+	job := &Job{
+		ID:           uuid.NewString(),
+		Status:       StatusRunning,
+		Deployment:   *deployment,
+		Applications: make(map[string]model.ApplicationStatus),
+		CreatedAt:    time.Now(),
+	}
+	r.jobs[job.ID] = job
+	r.running++
+
+	return job.snapshot(), nil
+}
+
+func (r *Registry) Get(id string) (Job, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return job.snapshot(), true
+}
+
+func (r *Registry) UpdateApplication(id string, status model.ApplicationStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok {
+		return
+	}
+
+	job.Applications[status.Key()] = status
+}
+
+func (r *Registry) Finish(id string, result *model.DeploymentResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.jobs[id]
+	if !ok || job.Status != StatusRunning {
+		return
+	}
+
+	r.running--
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Result = result
+
+	if result.Success {
+		job.Status = StatusSucceeded
+	} else {
+		job.Status = StatusFailed
+		job.Error = result.Error
+	}
+}
+
+// Run removes expired jobs until the context is cancelled.
+func (r *Registry) Run(ctx context.Context) {
+	interval := r.retention / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed := r.expire(time.Now()); removed > 0 {
+				log.Debugf("Removed %d expired job(s)", removed)
+			}
+		}
+	}
+}
+
+func (r *Registry) expire(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for id, job := range r.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > r.retention {
+			delete(r.jobs, id)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+func (j *Job) snapshot() Job {
+	snapshot := *j
+	snapshot.Applications = maps.Clone(j.Applications)
+
+	return snapshot
+}
@@ -0,0 +1,53 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/3lvia/deployvia/internal/model"
+)
+
+func TestRegistryMaxRunning(t *testing.T) {
+	registry := NewRegistry(time.Hour, 1)
+	deployment := &model.Deployment{ApplicationName: "demo-api", System: "core"}
+
+	job, err := registry.Create(deployment)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	var tooManyJobsError *model.TooManyJobsError
+	if _, err := registry.Create(deployment); !errors.As(err, &tooManyJobsError) {
+		t.Fatalf("Create() error = '%v', expected TooManyJobsError", err)
+	}
+
+	registry.Finish(job.ID, &model.DeploymentResult{Success: true})
+	// Finishing a job twice must not free another slot.
+	registry.Finish(job.ID, &model.DeploymentResult{Success: true})
+
+	if _, err := registry.Create(deployment); err != nil {
+		t.Fatalf("Create() after the running job finished error = %v", err)
+	}
+
+	if _, err := registry.Create(deployment); !errors.As(err, &tooManyJobsError) {
+		t.Errorf("Create() error = '%v', expected TooManyJobsError", err)
+	}
+}
+
+func TestRegistryUpdateApplication(t *testing.T) {
+	registry := NewRegistry(time.Hour, 1)
+
+	job, err := registry.Create(&model.Deployment{ApplicationName: "demo-api", System: "core"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	registry.UpdateApplication(job.ID, model.ApplicationStatus{Name: "core-demo-api", Namespace: "argocd"})
+	registry.UpdateApplication(job.ID, model.ApplicationStatus{Name: "core-demo-api", Namespace: "core"})
+
+	job, _ = registry.Get(job.ID)
+	if len(job.Applications) != 2 {
+		t.Errorf("Get() returned %d applications, expected applications in different namespaces to be kept apart", len(job.Applications))
+	}
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ResourceStatus struct {
+	Group         string `json:"group,omitempty"`
+	Kind          string `json:"kind"`
+	Namespace     string `json:"namespace,omitempty"`
+	Name          string `json:"name"`
+	SyncStatus    string `json:"sync_status,omitempty"`
+	HealthStatus  string `json:"health_status,omitempty"`
+	HealthMessage string `json:"health_message,omitempty"`
+}
+
+func (r ResourceStatus) String() string {
+	s := fmt.Sprintf("%s/%s", r.Kind, r.Name)
+	if r.Namespace != "" {
+		s = fmt.Sprintf("%s/%s/%s", r.Kind, r.Namespace, r.Name)
+	}
+
+	if r.HealthStatus != "" {
+		s = fmt.Sprintf("%s (%s)", s, r.HealthStatus)
+	} else if r.SyncStatus != "" {
+		s = fmt.Sprintf("%s (%s)", s, r.SyncStatus)
+	}
+
+	if r.HealthMessage != "" {
+		s = fmt.Sprintf("%s: %s", s, r.HealthMessage)
+	}
+
+	return s
+}
+
+const (
+	FailureReasonDegraded       = "Degraded"
+	FailureReasonSyncFailed     = "SyncFailed"
+	FailureReasonRolloutAborted = "RolloutAborted"
+	FailureReasonAnalysisFailed = "AnalysisFailed"
+)
+
+// ApplicationFailedError is returned when Argo CD reports that an application can not become healthy,
+// so that we don't have to wait for the timeout.
+type ApplicationFailedError struct {
+	Reason    string
+	Message   string
+	Resources []ResourceStatus
+}
+
+func (e *ApplicationFailedError) Error() string {
+	var b strings.Builder
+
+	switch e.Reason {
+	case FailureReasonDegraded:
+		b.WriteString("application is degraded")
+	case FailureReasonSyncFailed:
+		b.WriteString("sync operation failed")
+	case FailureReasonRolloutAborted:
+		b.WriteString("rollout was aborted")
+	case FailureReasonAnalysisFailed:
+		b.WriteString("rollout analysis failed")
+	default:
+		b.WriteString("application failed")
+	}
+
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+
+	if len(e.Resources) > 0 {
+		resources := make([]string, 0, len(e.Resources))
+		for _, resource := range e.Resources {
+			resources = append(resources, resource.String())
+		}
+
+		fmt.Fprintf(&b, "; failing resources: %s", strings.Join(resources, ", "))
+	}
+
+	return b.String()
+}
+
+// DeploymentTimeoutError is returned when the deadline of a request passes before all applications are deployed.
+type DeploymentTimeoutError struct {
+	Timeout             time.Duration
+	PendingApplications []string
+}
+
+func (e *DeploymentTimeoutError) Error() string {
+	return fmt.Sprintf(
+		"timed out after %s waiting for application(s) %s",
+		e.Timeout,
+		strings.Join(e.PendingApplications, ", "),
+	)
+}
+
+// WorkloadNotFoundError is returned when workloads are verified, but no Deployment, StatefulSet or Rollout of the application runs the image.
+type WorkloadNotFoundError struct {
+	Image string
+}
+
+func (e *WorkloadNotFoundError) Error() string {
+	return fmt.Sprintf("no Deployment, StatefulSet or Rollout of the application runs image %s", e.Image)
+}
+
+// ApplicationNotFoundError is returned when no application matches the deployment.
+type ApplicationNotFoundError struct {
+	LabelSelector string
+}
+
+func (e *ApplicationNotFoundError) Error() string {
+	return "application(s) not found"
+}
+
+// AmbiguousApplicationError is returned when several applications match a deployment that expects only one.
+type AmbiguousApplicationError struct {
+	Applications []string
+}
+
+func (e *AmbiguousApplicationError) Error() string {
+	return "multiple applications found when only one was expected"
+}
+
+// WatchFailedError is returned when applications can not be listed or watched, e.g. because the API server is unavailable.
+type WatchFailedError struct {
+	Err error
+}
+
+func (e *WatchFailedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *WatchFailedError) Unwrap() error {
+	return e.Err
+}
+
+// ApplicationSetCondition is an error reported in the 'status.conditions' of an ApplicationSet.
+type ApplicationSetCondition struct {
+	Type    string `json:"type"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message"`
+}
+
+func (c ApplicationSetCondition) String() string {
+	return fmt.Sprintf("%s: %s", c.Type, c.Message)
+}
+
+func formatApplicationSetConditions(conditions []ApplicationSetCondition) string {
+	messages := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		messages = append(messages, condition.String())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// ApplicationNotGeneratedError is returned when an ApplicationSet matches the deployment,
+// but has not generated an application for the requested cluster type, e.g. because the cluster was just added.
+type ApplicationNotGeneratedError struct {
+	ApplicationSet string
+	// Empty if the deployment checks all clusters.
+	ClusterType           string
+	GeneratedApplications []string
+	Conditions            []ApplicationSetCondition
+}
+
+func (e *ApplicationNotGeneratedError) Error() string {
+	var b strings.Builder
+
+	if e.ClusterType != "" {
+		fmt.Fprintf(&b, "applicationset %s has not generated an application for cluster type %s yet", e.ApplicationSet, e.ClusterType)
+	} else {
+		fmt.Fprintf(&b, "applicationset %s has not generated any applications yet", e.ApplicationSet)
+	}
+
+	if len(e.GeneratedApplications) > 0 {
+		fmt.Fprintf(&b, "; generated applications: %s", strings.Join(e.GeneratedApplications, ", "))
+	}
+
+	if len(e.Conditions) > 0 {
+		fmt.Fprintf(&b, "; errors: %s", formatApplicationSetConditions(e.Conditions))
+	}
+
+	return b.String()
+}
+
+// ApplicationSetFailedError is returned when the ApplicationSet that generated the applications reports errors,
+// since its applications may not reflect the latest changes even if they are healthy.
+type ApplicationSetFailedError struct {
+	ApplicationSet string
+	Conditions     []ApplicationSetCondition
+}
+
+func (e *ApplicationSetFailedError) Error() string {
+	return fmt.Sprintf("applicationset %s has errors: %s", e.ApplicationSet, formatApplicationSetConditions(e.Conditions))
+}
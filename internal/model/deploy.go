@@ -20,39 +20,57 @@ type Deployment struct {
 	CheckAllClusters bool   `json:"check_all_clusters,omitempty"`
 	Environment      string `json:"environment"`
 	Image            string `json:"image"`
+	// Sets 'argocd.argoproj.io/refresh=hard' on the application(s) before watching, requires the 'refresh' policy action.
+	Refresh bool `json:"refresh,omitempty"`
+	// Starts a sync operation on the application(s) before watching, requires the 'sync' policy action.
+	TriggerSync bool `json:"trigger_sync,omitempty"`
+	// Rolls failed application(s) back to the previous revision in their history, requires the 'rollback' policy action.
+	RollbackOnFailure bool `json:"rollback_on_failure,omitempty"`
+	// Waits until the workloads running the image are rolled out, and their pods run the image digest,
+	// instead of relying on the images in the manifests reported by Argo CD.
+	VerifyWorkloads bool `json:"verify_workloads,omitempty"`
+	// Considers the application deployed once its Argo Rollouts running the image are paused, e.g. at a canary step,
+	// for progressive pipelines that promote them later.
+	AcceptPausedRollout bool `json:"accept_paused_rollout,omitempty"`
+	// Includes the last logs of crashing containers in the diagnostics of failed application(s), requires the 'logs' policy action.
+	IncludeLogs bool `json:"include_logs,omitempty"`
 }
 
-func ValidateDeployment(deployment *Deployment) (*ValidatedDeployment, error) {
-	if deployment == nil {
-		return nil, fmt.Errorf("deployment is nil")
+// Actions returns the policy actions the deployment requires besides querying the application(s).
+func (d *Deployment) Actions() []string {
+	var actions []string
+	if d.Refresh {
+		actions = append(actions, PolicyActionRefresh)
 	}
 
-	if deployment.System == "" {
-		return nil, fmt.Errorf("system is required")
+	if d.TriggerSync {
+		actions = append(actions, PolicyActionSync)
 	}
 
-	if deployment.ApplicationName == "" {
-		return nil, fmt.Errorf("application name is required")
+	if d.RollbackOnFailure {
+		actions = append(actions, PolicyActionRollback)
 	}
 
-	re := regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+	if d.IncludeLogs {
+		actions = append(actions, PolicyActionLogs)
+	}
 
-	if !re.MatchString(deployment.System) {
-		return nil, fmt.Errorf("system name must only contain alphanumeric characters and hyphens")
+	return actions
+}
+
+func ValidateDeployment(deployment *Deployment) (*ValidatedDeployment, error) {
+	if deployment == nil {
+		return nil, fmt.Errorf("deployment is nil")
 	}
 
-	if !re.MatchString(deployment.ApplicationName) {
-		return nil, fmt.Errorf("application name must only contain alphanumeric characters and hyphens")
+	if err := validateApplication(deployment); err != nil {
+		return nil, err
 	}
 
 	if deployment.ClusterType == "" {
 		return nil, fmt.Errorf("cluster type is required")
 	}
 
-	if deployment.Environment == "" {
-		return nil, fmt.Errorf("environment is required")
-	}
-
 	if deployment.Image == "" {
 		return nil, fmt.Errorf("image is required")
 	}
@@ -68,3 +86,68 @@ func ValidateDeployment(deployment *Deployment) (*ValidatedDeployment, error) {
 
 	return &ValidatedDeployment{Deployment: deployment}, nil
 }
+
+// ValidateApplicationLookup validates a deployment used to look up the current status of applications,
+// which has no image and matches all clusters if the cluster type is not set.
+func ValidateApplicationLookup(deployment *Deployment) (*ValidatedDeployment, error) {
+	if deployment == nil {
+		return nil, fmt.Errorf("deployment is nil")
+	}
+
+	if err := validateApplication(deployment); err != nil {
+		return nil, err
+	}
+
+	// Unlike in deployments, these are taken from the query string and not checked against an image.
+	if !nameRegex.MatchString(deployment.Environment) {
+		return nil, fmt.Errorf("environment must only contain alphanumeric characters and hyphens")
+	}
+
+	if deployment.ClusterType == "" {
+		deployment.CheckAllClusters = true
+	} else if !nameRegex.MatchString(deployment.ClusterType) {
+		return nil, fmt.Errorf("cluster type must only contain alphanumeric characters and hyphens")
+	}
+
+	return &ValidatedDeployment{Deployment: deployment}, nil
+}
+
+var nameRegex = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// Validates the fields that identify the application, which are used in label selectors.
+func validateApplication(deployment *Deployment) error {
+	if deployment.System == "" {
+		return fmt.Errorf("system is required")
+	}
+
+	if deployment.ApplicationName == "" {
+		return fmt.Errorf("application name is required")
+	}
+
+	if !nameRegex.MatchString(deployment.System) {
+		return fmt.Errorf("system name must only contain alphanumeric characters and hyphens")
+	}
+
+	if !nameRegex.MatchString(deployment.ApplicationName) {
+		return fmt.Errorf("application name must only contain alphanumeric characters and hyphens")
+	}
+
+	if deployment.Environment == "" {
+		return fmt.Errorf("environment is required")
+	}
+
+	return nil
+}
+
+// ValidationError is returned when a request is malformed, e.g. the deployment is invalid or a header can not be parsed.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Diagnostics explain why an application was not deployed, collected once watching it failed or timed out.
+type Diagnostics struct {
+	// Resources of the application that are not healthy or out of sync.
+	Resources []ResourceStatus `json:"resources,omitempty"`
+	// The 'status.conditions' of the application, e.g. comparison or sync errors.
+	Conditions []ApplicationCondition `json:"conditions,omitempty"`
+	// Recent events of the workloads of the application and their pods, newest first.
+	Events []EventDiagnostics `json:"events,omitempty"`
+	// Pods with containers that can not start, e.g. in 'CrashLoopBackOff' or 'ImagePullBackOff'.
+	Pods []PodDiagnostics `json:"pods,omitempty"`
+	// Set if the diagnostics were cut to fit the size limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type ApplicationCondition struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type EventDiagnostics struct {
+	// The involved object, e.g. 'Pod/demo-api-7d9f8-abcde'.
+	Object   string `json:"object"`
+	Type     string `json:"type"`
+	Reason   string `json:"reason"`
+	Message  string `json:"message"`
+	Count    int64  `json:"count,omitempty"`
+	LastSeen string `json:"last_seen,omitempty"`
+}
+
+type PodDiagnostics struct {
+	Namespace  string                 `json:"namespace"`
+	Name       string                 `json:"name"`
+	Phase      string                 `json:"phase"`
+	Containers []ContainerDiagnostics `json:"containers"`
+}
+
+type ContainerDiagnostics struct {
+	Name string `json:"name"`
+	// The reason the container is waiting, e.g. 'CrashLoopBackOff'.
+	Reason       string `json:"reason"`
+	Message      string `json:"message,omitempty"`
+	RestartCount int64  `json:"restart_count"`
+	// Why the previous run of the container terminated, if it was restarted.
+	LastTerminationReason   string `json:"last_termination_reason,omitempty"`
+	LastTerminationExitCode *int64 `json:"last_termination_exit_code,omitempty"`
+	LastTerminationMessage  string `json:"last_termination_message,omitempty"`
+	// The last lines logged by the previous run of the container.
+	Logs string `json:"logs,omitempty"`
+}
+
+// Truncate cuts the diagnostics until they are at most 'maxBytes' when encoded as JSON,
+// first shortening the logs, then dropping the oldest events, pods and resources.
+func (d *Diagnostics) Truncate(maxBytes int) {
+	fits := func() bool {
+		encoded, err := json.Marshal(d)
+
+		return err == nil && len(encoded) <= maxBytes
+	}
+
+	if fits() {
+		return
+	}
+
+	d.Truncated = true
+
+	for d.hasLogs() && !fits() {
+		for i := range d.Pods {
+			for j := range d.Pods[i].Containers {
+				d.Pods[i].Containers[j].Logs = halveLogs(d.Pods[i].Containers[j].Logs)
+			}
+		}
+	}
+
+	for len(d.Events) > 0 && !fits() {
+		d.Events = d.Events[:len(d.Events)-1]
+	}
+
+	for len(d.Pods) > 0 && !fits() {
+		d.Pods = d.Pods[:len(d.Pods)-1]
+	}
+
+	for len(d.Resources) > 0 && !fits() {
+		d.Resources = d.Resources[:len(d.Resources)-1]
+	}
+
+	for len(d.Conditions) > 0 && !fits() {
+		d.Conditions = d.Conditions[:len(d.Conditions)-1]
+	}
+}
+
+func (d *Diagnostics) hasLogs() bool {
+	for _, pod := range d.Pods {
+		for _, container := range pod.Containers {
+			if container.Logs != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Keeps the last half of the log lines, since the last lines usually explain why the container exited.
+func halveLogs(logs string) string {
+	lines := strings.Split(strings.TrimSuffix(logs, "\n"), "\n")
+	if len(lines) <= 1 {
+		return ""
+	}
+
+	return strings.Join(lines[len(lines)/2:], "\n") + "\n"
+}
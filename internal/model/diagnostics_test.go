@@ -0,0 +1,81 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiagnosticsTruncate(t *testing.T) {
+	newDiagnostics := func() *Diagnostics {
+		var logs strings.Builder
+		for i := range 100 {
+			fmt.Fprintf(&logs, "line %d: connection refused\n", i)
+		}
+
+		diagnostics := &Diagnostics{
+			Resources:  []ResourceStatus{{Kind: "Deployment", Namespace: "core", Name: "demo-api", HealthStatus: "Degraded"}},
+			Conditions: []ApplicationCondition{{Type: "SyncError", Message: "one or more objects failed to apply"}},
+			Pods: []PodDiagnostics{{
+				Namespace: "core",
+				Name:      "demo-api-7d9f8-abcde",
+				Phase:     "Running",
+				Containers: []ContainerDiagnostics{
+					{Name: "demo-api", Reason: "CrashLoopBackOff", RestartCount: 5, Logs: logs.String()},
+				},
+			}},
+		}
+
+		for i := range 50 {
+			diagnostics.Events = append(diagnostics.Events, EventDiagnostics{
+				Object:  "Pod/demo-api-7d9f8-abcde",
+				Type:    "Warning",
+				Reason:  "BackOff",
+				Message: fmt.Sprintf("Back-off restarting failed container %d", i),
+			})
+		}
+
+		return diagnostics
+	}
+
+	tests := []struct {
+		name              string
+		maxBytes          int
+		expectedTruncated bool
+		expectedEvents    int
+	}{
+		{name: "fits", maxBytes: 64 * 1024, expectedEvents: 50},
+		{name: "logs shortened", maxBytes: 8 * 1024, expectedTruncated: true, expectedEvents: 50},
+		{name: "events dropped", maxBytes: 2 * 1024, expectedTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := newDiagnostics()
+			diagnostics.Truncate(tt.maxBytes)
+
+			data, err := json.Marshal(diagnostics)
+			if err != nil {
+				t.Fatalf("Failed to marshal diagnostics: %v", err)
+			}
+
+			if len(data) > tt.maxBytes {
+				t.Errorf("Truncate() = %d bytes, expected at most %d", len(data), tt.maxBytes)
+			}
+
+			if diagnostics.Truncated != tt.expectedTruncated {
+				t.Errorf("Truncate() truncated = %t, expected %t", diagnostics.Truncated, tt.expectedTruncated)
+			}
+
+			if tt.expectedEvents > 0 && len(diagnostics.Events) != tt.expectedEvents {
+				t.Errorf("Truncate() kept %d events, expected %d", len(diagnostics.Events), tt.expectedEvents)
+			}
+
+			// The last lines are kept, since they usually explain why the container exited.
+			if logs := diagnostics.Pods[0].Containers[0].Logs; logs != "" && !strings.HasSuffix(logs, "line 99: connection refused\n") {
+				t.Errorf("Truncate() logs end with %q, expected the last line to be kept", logs[max(0, len(logs)-40):])
+			}
+		})
+	}
+}
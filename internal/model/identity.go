@@ -0,0 +1,117 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CallerIdentity is the identity of a caller, normalised from the claims of its CI provider's token.
+// It is used for logging and authorization, see 'Policy.Authorize'.
+type CallerIdentity struct {
+	Provider      string
+	TrustedIssuer string
+	Subject       string
+	// GitHub 'repository_owner', GitLab 'namespace_path' or Azure DevOps organization.
+	Owner string
+	// GitHub 'repository', GitLab 'project_path' or Azure DevOps 'organization/project'.
+	Repository string
+	// GitHub 'job_workflow_ref' or GitLab 'ci_config_ref_uri'.
+	JobWorkflowRef string
+	// Fully qualified Git ref, e.g. 'refs/heads/trunk'.
+	Ref         string
+	Environment string
+	// Kubernetes ServiceAccount as 'namespace/name'.
+	ServiceAccount string
+
+	// The token's 'jti' and 'exp' claims, used for replay protection.
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Name describes the caller in logs and error messages.
+func (i *CallerIdentity) Name() string {
+	if i.ServiceAccount != "" {
+		return "service account " + i.ServiceAccount
+	}
+
+	return "repository " + i.Repository
+}
+
+// TokenMissingError is returned when none of the token headers of the identity providers are set.
+type TokenMissingError struct {
+	TokenHeaders []string
+}
+
+func (e *TokenMissingError) Error() string {
+	if len(e.TokenHeaders) == 1 {
+		return fmt.Sprintf("%s header is required", e.TokenHeaders[0])
+	}
+
+	return fmt.Sprintf("one of the %s headers is required", strings.Join(e.TokenHeaders, ", "))
+}
+
+// TokenInvalidError is returned when a token is not accepted by its identity provider, or has already been used.
+type TokenInvalidError struct {
+	Err error
+}
+
+func (e *TokenInvalidError) Error() string {
+	return fmt.Sprintf("invalid token: %v", e.Err)
+}
+
+func (e *TokenInvalidError) Unwrap() error {
+	return e.Err
+}
+
+// IdentityProvider authenticates callers using tokens issued by a CI provider.
+type IdentityProvider interface {
+	Name() string
+	// TokenHeader is the HTTP header callers put their token in.
+	TokenHeader() string
+	Authenticate(ctx context.Context, tokenString string) (*CallerIdentity, error)
+}
+
+const (
+	IdentityProviderGitHubActions = "github-actions"
+	IdentityProviderGitLabCI      = "gitlab-ci"
+	IdentityProviderAzureDevOps   = "azure-devops"
+)
+
+// Creates an identity provider for each provider that has at least one trusted issuer.
+func NewIdentityProviders(trustedIssuers []TrustedIssuer) ([]IdentityProvider, error) {
+	var (
+		gitHubActions []TrustedIssuer
+		gitLabCI      []TrustedIssuer
+		azureDevOps   []TrustedIssuer
+	)
+
+	for _, trustedIssuer := range trustedIssuers {
+		switch trustedIssuer.Provider {
+		case IdentityProviderGitHubActions, "":
+			gitHubActions = append(gitHubActions, trustedIssuer)
+		case IdentityProviderGitLabCI:
+			gitLabCI = append(gitLabCI, trustedIssuer)
+		case IdentityProviderAzureDevOps:
+			azureDevOps = append(azureDevOps, trustedIssuer)
+		default:
+			return nil, fmt.Errorf("trusted issuer %s: unknown provider %s", trustedIssuer.Name, trustedIssuer.Provider)
+		}
+	}
+
+	var identityProviders []IdentityProvider
+	if len(gitHubActions) > 0 {
+		identityProviders = append(identityProviders, NewGitHubActionsProvider(gitHubActions))
+	}
+
+	if len(gitLabCI) > 0 {
+		identityProviders = append(identityProviders, NewGitLabCIProvider(gitLabCI))
+	}
+
+	if len(azureDevOps) > 0 {
+		identityProviders = append(identityProviders, NewAzureDevOpsProvider(azureDevOps))
+	}
+
+	return identityProviders, nil
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const IdentityProviderKubernetes = "kubernetes"
+
+// ServiceAccountAuth configures authentication of in-cluster callers with projected ServiceAccount tokens.
+type ServiceAccountAuth struct {
+	// Audiences the token must be issued for, e.g. 'deployvia'.
+	Audiences []string `json:"audiences"`
+	// Namespaces whose ServiceAccounts are accepted; empty means all namespaces.
+	AllowedNamespaces []string `json:"allowed_namespaces,omitempty"`
+}
+
+type kubernetesProvider struct {
+	client             kubernetes.Interface
+	serviceAccountAuth ServiceAccountAuth
+}
+
+// NewKubernetesProvider authenticates ServiceAccount tokens using the TokenReview API.
+func NewKubernetesProvider(client kubernetes.Interface, serviceAccountAuth ServiceAccountAuth) (IdentityProvider, error) {
+	if len(serviceAccountAuth.Audiences) == 0 {
+		return nil, fmt.Errorf("ServiceAccount authentication requires at least one audience")
+	}
+
+	return &kubernetesProvider{
+		client:             client,
+		serviceAccountAuth: serviceAccountAuth,
+	}, nil
+}
+
+func (p *kubernetesProvider) Name() string {
+	return IdentityProviderKubernetes
+}
+
+func (p *kubernetesProvider) TokenHeader() string {
+	return "X-Kubernetes-Token"
+}
+
+func (p *kubernetesProvider) Authenticate(ctx context.Context, tokenString string) (*CallerIdentity, error) {
+	tokenReview, err := p.client.AuthenticationV1().TokenReviews().Create(
+		ctx,
+		&authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{
+				Token:     tokenString,
+				Audiences: p.serviceAccountAuth.Audiences,
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review token: %v", err)
+	}
+
+	if !tokenReview.Status.Authenticated {
+		if tokenReview.Status.Error != "" {
+			return nil, fmt.Errorf("token is not authenticated: %s", tokenReview.Status.Error)
+		}
+
+		return nil, fmt.Errorf("token is not authenticated")
+	}
+
+	username := tokenReview.Status.User.Username
+
+	// ServiceAccount usernames are in the format 'system:serviceaccount:<namespace>:<name>'.
+	parts := strings.Split(username, ":")
+	if len(parts) != 4 || parts[0] != "system" || parts[1] != "serviceaccount" {
+		return nil, fmt.Errorf("user %s is not a ServiceAccount", username)
+	}
+
+	namespace, name := parts[2], parts[3]
+
+	if len(p.serviceAccountAuth.AllowedNamespaces) > 0 &&
+		!slices.Contains(p.serviceAccountAuth.AllowedNamespaces, namespace) {
+		return nil, fmt.Errorf("namespace %s is not valid", namespace)
+	}
+
+	identity := &CallerIdentity{
+		Provider:       IdentityProviderKubernetes,
+		Subject:        username,
+		Owner:          namespace,
+		ServiceAccount: namespace + "/" + name,
+	}
+
+	// The token ID is exposed as 'JTI=<jti>' in the credential ID of bound ServiceAccount tokens.
+	for _, credentialID := range tokenReview.Status.User.Extra["authentication.kubernetes.io/credential-id"] {
+		if jti, found := strings.CutPrefix(credentialID, "JTI="); found {
+			identity.TokenID = jti
+		}
+	}
+
+	// The token has been verified by the API server, so we only read its expiration time.
+	if token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{}); err == nil {
+		if exp, err := token.Claims.GetExpirationTime(); err == nil && exp != nil {
+			identity.ExpiresAt = exp.Time
+		}
+	}
+
+	return identity, nil
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Creates a fake clientset that authenticates the given tokens as the given users, if the audience is 'deployvia'.
+func newFakeTokenReviewClient(users map[string]string) *fake.Clientset {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReview := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview).DeepCopy()
+
+		username, ok := users[tokenReview.Spec.Token]
+		if !ok || !slices.Contains(tokenReview.Spec.Audiences, "deployvia") {
+			tokenReview.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: false,
+				Error:         "invalid bearer token",
+			}
+
+			return true, tokenReview, nil
+		}
+
+		tokenReview.Status = authenticationv1.TokenReviewStatus{
+			Authenticated: true,
+			User:          authenticationv1.UserInfo{Username: username},
+			Audiences:     tokenReview.Spec.Audiences,
+		}
+
+		return true, tokenReview, nil
+	})
+
+	return client
+}
+
+func TestKubernetesProvider(t *testing.T) {
+	client := newFakeTokenReviewClient(map[string]string{
+		"smoke-tests-token": "system:serviceaccount:smoke-tests:runner",
+		"other-token":       "system:serviceaccount:other:runner",
+		"user-token":        "jane@example.com",
+	})
+
+	tests := []struct {
+		name             string
+		audiences        []string
+		token            string
+		expectedIdentity *CallerIdentity
+		expectError      bool
+	}{
+		{
+			name:      "valid ServiceAccount token",
+			audiences: []string{"deployvia"},
+			token:     "smoke-tests-token",
+			expectedIdentity: &CallerIdentity{
+				Provider:       IdentityProviderKubernetes,
+				Subject:        "system:serviceaccount:smoke-tests:runner",
+				Owner:          "smoke-tests",
+				ServiceAccount: "smoke-tests/runner",
+			},
+		},
+		{
+			name:        "wrong audience",
+			audiences:   []string{"kubernetes"},
+			token:       "smoke-tests-token",
+			expectError: true,
+		},
+		{
+			name:        "unknown token",
+			audiences:   []string{"deployvia"},
+			token:       "invalid-token",
+			expectError: true,
+		},
+		{
+			name:        "namespace not allowed",
+			audiences:   []string{"deployvia"},
+			token:       "other-token",
+			expectError: true,
+		},
+		{
+			name:        "not a ServiceAccount",
+			audiences:   []string{"deployvia"},
+			token:       "user-token",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identityProvider, err := NewKubernetesProvider(client, ServiceAccountAuth{
+				Audiences:         tt.audiences,
+				AllowedNamespaces: []string{"smoke-tests"},
+			})
+			if err != nil {
+				t.Fatalf("NewKubernetesProvider() error = '%v'", err)
+			}
+
+			identity, err := identityProvider.Authenticate(context.Background(), tt.token)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Authenticate() error = '%v', expectError %v", err, tt.expectError)
+			}
+
+			if tt.expectedIdentity != nil && *identity != *tt.expectedIdentity {
+				t.Errorf("Authenticate() = %+v, expected %+v", identity, tt.expectedIdentity)
+			}
+		})
+	}
+}
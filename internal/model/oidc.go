@@ -3,25 +3,110 @@ package model
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/MicahParks/keyfunc/v3"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type ValidatedClaims struct {
-	RepositoryOwner string
-	Repository      string
+// TrustedIssuer is an OIDC token issuer we accept tokens from, e.g. GitHub Actions or a GitHub Enterprise Server instance.
+type TrustedIssuer struct {
+	Name string `json:"name"`
+	// One of 'github-actions' (default), 'gitlab-ci' or 'azure-devops'.
+	Provider      string   `json:"provider,omitempty"`
+	Issuer        string   `json:"issuer"`
+	JWKSURL       string   `json:"jwks_url"`
+	Audiences     []string `json:"audiences"`
+	AllowedOwners []string `json:"allowed_owners"`
+
+	// Shared JWKS cache for JWKSURL, see 'config.New'.
+	Keyfunc keyfunc.Keyfunc `json:"-"`
 }
 
-// Fetch the JWKS and use it to create a verification key function.
-func createKeyFunc(ctx context.Context, jwksURL string) (jwt.Keyfunc, error) {
-	k, err := keyfunc.NewDefaultCtx(ctx, []string{jwksURL})
+func ValidateTrustedIssuer(trustedIssuer *TrustedIssuer) error {
+	if trustedIssuer.Name == "" {
+		return fmt.Errorf("trusted issuer name is required")
+	}
+
+	if trustedIssuer.Issuer == "" {
+		return fmt.Errorf("trusted issuer %s: issuer is required", trustedIssuer.Name)
+	}
+
+	if trustedIssuer.JWKSURL == "" {
+		return fmt.Errorf("trusted issuer %s: JWKS URL is required", trustedIssuer.Name)
+	}
+
+	if len(trustedIssuer.Audiences) == 0 {
+		return fmt.Errorf("trusted issuer %s: at least one audience is required", trustedIssuer.Name)
+	}
+
+	if len(trustedIssuer.AllowedOwners) == 0 {
+		return fmt.Errorf("trusted issuer %s: at least one allowed owner is required", trustedIssuer.Name)
+	}
+
+	return nil
+}
+
+// oidcProvider validates OIDC tokens from its trusted issuers,
+// and leaves the provider specific claims to the 'identity' function.
+type oidcProvider struct {
+	name           string
+	tokenHeader    string
+	trustedIssuers []TrustedIssuer
+	identity       func(claims jwt.MapClaims, trustedIssuer *TrustedIssuer) (*CallerIdentity, error)
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) TokenHeader() string {
+	return p.tokenHeader
+}
+
+// Validates the token against the trusted issuer matching its 'iss' claim.
+// Errors after the issuer has been found identify the trusted issuer that rejected the token.
+func (p *oidcProvider) Authenticate(ctx context.Context, tokenString string) (*CallerIdentity, error) {
+	iss, err := getUnverifiedIssuer(tokenString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify token: %v", err)
+	}
+
+	trustedIssuer, err := findTrustedIssuer(p.trustedIssuers, iss)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := verifyToken(tokenString, trustedIssuer.Keyfunc.KeyfuncCtx(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("trusted issuer %s: failed to verify token: %v", trustedIssuer.Name, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("trusted issuer %s: failed to parse claims", trustedIssuer.Name)
+	}
+
+	if err := validateRegisteredClaims(claims, trustedIssuer); err != nil {
+		return nil, fmt.Errorf("trusted issuer %s: failed to validate claims: %v", trustedIssuer.Name, err)
+	}
+
+	identity, err := p.identity(claims, trustedIssuer)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create keyfunc: %v", err)
+		return nil, fmt.Errorf("trusted issuer %s: failed to validate claims: %v", trustedIssuer.Name, err)
+	}
+
+	identity.Provider = p.name
+	identity.TrustedIssuer = trustedIssuer.Name
+	identity.Subject, _ = claims.GetSubject()
+	identity.TokenID, _ = claims["jti"].(string)
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		identity.ExpiresAt = exp.Time
 	}
 
-	return k.Keyfunc, nil
+	return identity, nil
 }
 
 func verifyToken(tokenString string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
@@ -33,95 +118,83 @@ func verifyToken(tokenString string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
 	return token, nil
 }
 
-func validateClaims(claims jwt.MapClaims) (*ValidatedClaims, error) {
+// Reads the issuer from the token without verifying the signature, so that we know which keys to verify it with.
+func getUnverifiedIssuer(tokenString string) (string, error) {
+	token, _, err := jwt.NewParser().ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return "", err
+	}
+
+	return token.Claims.GetIssuer()
+}
+
+func findTrustedIssuer(trustedIssuers []TrustedIssuer, iss string) (*TrustedIssuer, error) {
+	for i := range trustedIssuers {
+		if trustedIssuers[i].Issuer == iss {
+			return &trustedIssuers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("issuer %s is not trusted", iss)
+}
+
+func validateRegisteredClaims(claims jwt.MapClaims, trustedIssuer *TrustedIssuer) error {
 	iss, err := claims.GetIssuer()
 	if err != nil {
-		return nil, fmt.Errorf("error getting issuer: %s", err)
+		return fmt.Errorf("error getting issuer: %s", err)
 	}
 
-	if iss != "https://token.actions.githubusercontent.com" {
-		return nil, fmt.Errorf("invalid issuer: %s", iss)
+	if iss != trustedIssuer.Issuer {
+		return fmt.Errorf("invalid issuer: %s", iss)
 	}
 
 	aud, err := claims.GetAudience()
 	if err != nil {
-		return nil, fmt.Errorf("error getting audience: %s", err)
+		return fmt.Errorf("error getting audience: %s", err)
 	}
 
 	if len(aud) == 0 {
-		return nil, fmt.Errorf("audience is empty")
+		return fmt.Errorf("audience is empty")
 	}
 
-	if aud[0] != "https://github.com/3lvia" {
-		return nil, fmt.Errorf("invalid audience: %s", aud[0])
+	if !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(trustedIssuer.Audiences, a) }) {
+		return fmt.Errorf("invalid audience: %v", aud)
 	}
 
 	exp, err := claims.GetExpirationTime()
 	if err != nil {
-		return nil, fmt.Errorf("error getting expiration time: %s", err)
+		return fmt.Errorf("error getting expiration time: %s", err)
 	}
 
 	if exp.IsZero() {
-		return nil, fmt.Errorf("expiration time is zero")
+		return fmt.Errorf("expiration time is zero")
 	}
 
 	if exp.Before(time.Now()) {
-		return nil, fmt.Errorf("token is expired")
+		return fmt.Errorf("token is expired")
 	}
 
 	iat, err := claims.GetIssuedAt()
 	if err != nil {
-		return nil, fmt.Errorf("error getting issued at: %s", err)
+		return fmt.Errorf("error getting issued at: %s", err)
 	}
 
 	if iat.IsZero() {
-		return nil, fmt.Errorf("issued at time is zero")
+		return fmt.Errorf("issued at time is zero")
 	}
 
 	if iat.After(time.Now()) {
-		return nil, fmt.Errorf("token is not yet valid")
-	}
-
-	repositoryOwner, ok := claims["repository_owner"].(string)
-	if !ok {
-		return nil, fmt.Errorf("repository_owner claim is missing or not a string")
+		return fmt.Errorf("token is not yet valid")
 	}
 
-	if repositoryOwner != "3lvia" {
-		return nil, fmt.Errorf("repository owner %s is not valid", repositoryOwner)
-	}
-
-	repository, ok := claims["repository"].(string)
-	if !ok {
-		return nil, fmt.Errorf("repository claim is missing or not a string")
-	}
-
-	return &ValidatedClaims{
-		RepositoryOwner: repositoryOwner,
-		Repository:      repository,
-	}, nil
+	return nil
 }
 
-func ValidateToken(ctx context.Context, tokenString string, jwksURL string) (*ValidatedClaims, error) {
-	keyFunc, err := createKeyFunc(ctx, jwksURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create keyfunc: %v", err)
-	}
-
-	token, err := verifyToken(tokenString, keyFunc)
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify token: %v", err)
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
+func getStringClaim(claims jwt.MapClaims, name string) (string, error) {
+	value, ok := claims[name].(string)
 	if !ok {
-		return nil, fmt.Errorf("failed to parse claims")
-	}
-
-	validatedClaims, err := validateClaims(claims)
-	if err != nil {
-		return nil, fmt.Errorf("failed to validate claims: %v", err)
+		return "", fmt.Errorf("%s claim is missing or not a string", name)
 	}
 
-	return validatedClaims, nil
+	return value, nil
 }
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func NewAzureDevOpsProvider(trustedIssuers []TrustedIssuer) IdentityProvider {
+	return &oidcProvider{
+		name:           IdentityProviderAzureDevOps,
+		tokenHeader:    "X-Azure-DevOps-OIDC-Token",
+		trustedIssuers: trustedIssuers,
+		identity:       azureDevOpsIdentity,
+	}
+}
+
+// Azure DevOps workload identity tokens only identify the service connection,
+// with a subject in the format 'sc://<organization>/<project>/<service connection>'.
+func azureDevOpsIdentity(claims jwt.MapClaims, trustedIssuer *TrustedIssuer) (*CallerIdentity, error) {
+	subject, err := getStringClaim(claims, "sub")
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(strings.TrimPrefix(subject, "sc://"), "/")
+	if !strings.HasPrefix(subject, "sc://") || len(parts) != 3 || slices.Contains(parts, "") {
+		return nil, fmt.Errorf("subject %s is not a service connection", subject)
+	}
+
+	organization, project := parts[0], parts[1]
+
+	if !slices.Contains(trustedIssuer.AllowedOwners, organization) {
+		return nil, fmt.Errorf("organization %s is not valid", organization)
+	}
+
+	return &CallerIdentity{
+		Owner:      organization,
+		Repository: organization + "/" + project,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func NewGitHubActionsProvider(trustedIssuers []TrustedIssuer) IdentityProvider {
+	return &oidcProvider{
+		name:           IdentityProviderGitHubActions,
+		tokenHeader:    "X-GitHub-OIDC-Token",
+		trustedIssuers: trustedIssuers,
+		identity:       gitHubActionsIdentity,
+	}
+}
+
+func gitHubActionsIdentity(claims jwt.MapClaims, trustedIssuer *TrustedIssuer) (*CallerIdentity, error) {
+	repositoryOwner, err := getStringClaim(claims, "repository_owner")
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(trustedIssuer.AllowedOwners, repositoryOwner) {
+		return nil, fmt.Errorf("repository owner %s is not valid", repositoryOwner)
+	}
+
+	repository, err := getStringClaim(claims, "repository")
+	if err != nil {
+		return nil, err
+	}
+
+	// These claims are not present for all workflows, e.g. 'environment' is only set for jobs that use a GitHub environment.
+	jobWorkflowRef, _ := claims["job_workflow_ref"].(string)
+	ref, _ := claims["ref"].(string)
+	environment, _ := claims["environment"].(string)
+
+	return &CallerIdentity{
+		Owner:          repositoryOwner,
+		Repository:     repository,
+		JobWorkflowRef: jobWorkflowRef,
+		Ref:            ref,
+		Environment:    environment,
+	}, nil
+}
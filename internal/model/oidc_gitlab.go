@@ -0,0 +1,56 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func NewGitLabCIProvider(trustedIssuers []TrustedIssuer) IdentityProvider {
+	return &oidcProvider{
+		name:           IdentityProviderGitLabCI,
+		tokenHeader:    "X-GitLab-OIDC-Token",
+		trustedIssuers: trustedIssuers,
+		identity:       gitLabCIIdentity,
+	}
+}
+
+// GitLab namespaces can be nested, so an allowed owner also allows all of its subgroups.
+func gitLabCIIdentity(claims jwt.MapClaims, trustedIssuer *TrustedIssuer) (*CallerIdentity, error) {
+	namespacePath, err := getStringClaim(claims, "namespace_path")
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.ContainsFunc(trustedIssuer.AllowedOwners, func(owner string) bool {
+		return namespacePath == owner || strings.HasPrefix(namespacePath, owner+"/")
+	}) {
+		return nil, fmt.Errorf("namespace %s is not valid", namespacePath)
+	}
+
+	projectPath, err := getStringClaim(claims, "project_path")
+	if err != nil {
+		return nil, err
+	}
+
+	ref, _ := claims["ref"].(string)
+	switch refType, _ := claims["ref_type"].(string); refType {
+	case "branch":
+		ref = "refs/heads/" + ref
+	case "tag":
+		ref = "refs/tags/" + ref
+	}
+
+	ciConfigRefURI, _ := claims["ci_config_ref_uri"].(string)
+	environment, _ := claims["environment"].(string)
+
+	return &CallerIdentity{
+		Owner:          namespacePath,
+		Repository:     projectPath,
+		JobWorkflowRef: ciConfigRefURI,
+		Ref:            ref,
+		Environment:    environment,
+	}, nil
+}
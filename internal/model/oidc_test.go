@@ -0,0 +1,327 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MicahParks/jwkset"
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testKID = "test-key"
+
+// Serves a JWKS with a locally generated key, returning the key to sign test tokens with.
+func setupJWKSServer(t *testing.T) (*rsa.PrivateKey, keyfunc.Keyfunc) {
+	ctx := context.Background()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	jwk, err := jwkset.NewJWKFromKey(privateKey.Public(), jwkset.JWKOptions{
+		Metadata: jwkset.JWKMetadataOptions{
+			ALG: jwkset.AlgRS256,
+			KID: testKID,
+			USE: jwkset.UseSig,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create JWK: %v", err)
+	}
+
+	storage := jwkset.NewMemoryStorage()
+	if err := storage.KeyWrite(ctx, jwk); err != nil {
+		t.Fatalf("Failed to write JWK: %v", err)
+	}
+
+	jwks, err := storage.JSONPublic(ctx)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWKS: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	k, err := keyfunc.NewDefaultCtx(t.Context(), []string{server.URL})
+	if err != nil {
+		t.Fatalf("Failed to create keyfunc: %v", err)
+	}
+
+	return privateKey, k
+}
+
+func signToken(t *testing.T, privateKey *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKID
+
+	tokenString, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	return tokenString
+}
+
+func registeredClaims(issuer string, audience string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": issuer,
+		"aud": audience,
+		"exp": float64(time.Now().Add(5 * time.Minute).Unix()),
+		"iat": float64(time.Now().Add(-1 * time.Minute).Unix()),
+	}
+}
+
+func withClaims(claims jwt.MapClaims, extra jwt.MapClaims) jwt.MapClaims {
+	for key, value := range extra {
+		claims[key] = value
+	}
+
+	return claims
+}
+
+func TestIdentityProviders(t *testing.T) {
+	privateKey, k := setupJWKSServer(t)
+
+	const (
+		gitHubIssuer      = "https://token.actions.githubusercontent.com"
+		gitHubAudience    = "https://github.com/3lvia"
+		gitLabIssuer      = "https://gitlab.com"
+		gitLabAudience    = "https://deployvia.elvia.io"
+		azureDevOpsIssuer = "https://vstoken.dev.azure.com/00000000-0000-0000-0000-000000000000"
+		azureAudience     = "api://AzureADTokenExchange"
+	)
+
+	identityProviders, err := NewIdentityProviders([]TrustedIssuer{
+		{
+			Name:          "github",
+			Issuer:        gitHubIssuer,
+			Audiences:     []string{gitHubAudience},
+			AllowedOwners: []string{"3lvia"},
+			Keyfunc:       k,
+		},
+		{
+			Name:          "ghes",
+			Provider:      IdentityProviderGitHubActions,
+			Issuer:        "https://ghes.example.com/_services/token",
+			Audiences:     []string{gitHubAudience},
+			AllowedOwners: []string{"3lvia-enterprise"},
+			Keyfunc:       k,
+		},
+		{
+			Name:          "gitlab",
+			Provider:      IdentityProviderGitLabCI,
+			Issuer:        gitLabIssuer,
+			Audiences:     []string{gitLabAudience},
+			AllowedOwners: []string{"elvia"},
+			Keyfunc:       k,
+		},
+		{
+			Name:          "azure-devops",
+			Provider:      IdentityProviderAzureDevOps,
+			Issuer:        azureDevOpsIssuer,
+			Audiences:     []string{azureAudience},
+			AllowedOwners: []string{"elvia"},
+			Keyfunc:       k,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewIdentityProviders() error = '%v'", err)
+	}
+
+	getIdentityProvider := func(name string) IdentityProvider {
+		for _, identityProvider := range identityProviders {
+			if identityProvider.Name() == name {
+				return identityProvider
+			}
+		}
+
+		t.Fatalf("Identity provider %s not found", name)
+
+		return nil
+	}
+
+	tests := []struct {
+		name             string
+		provider         string
+		claims           jwt.MapClaims
+		expectedIdentity *CallerIdentity
+		expectedError    string
+	}{
+		{
+			name:     "github actions",
+			provider: IdentityProviderGitHubActions,
+			claims: withClaims(registeredClaims(gitHubIssuer, gitHubAudience), jwt.MapClaims{
+				"sub":              "repo:3lvia/core-demo-api:ref:refs/heads/trunk",
+				"jti":              "2b1b8a7e-2d0e-4a4b-9f3c-6f0f4c3d2a1b",
+				"repository_owner": "3lvia",
+				"repository":       "3lvia/core-demo-api",
+				"job_workflow_ref": "3lvia/core-demo-api/.github/workflows/deploy.yml@refs/heads/trunk",
+				"ref":              "refs/heads/trunk",
+			}),
+			expectedIdentity: &CallerIdentity{
+				Provider:       IdentityProviderGitHubActions,
+				TrustedIssuer:  "github",
+				Subject:        "repo:3lvia/core-demo-api:ref:refs/heads/trunk",
+				Owner:          "3lvia",
+				Repository:     "3lvia/core-demo-api",
+				JobWorkflowRef: "3lvia/core-demo-api/.github/workflows/deploy.yml@refs/heads/trunk",
+				Ref:            "refs/heads/trunk",
+				TokenID:        "2b1b8a7e-2d0e-4a4b-9f3c-6f0f4c3d2a1b",
+			},
+		},
+		{
+			name:     "github actions with wrong owner for trusted issuer",
+			provider: IdentityProviderGitHubActions,
+			claims: withClaims(registeredClaims("https://ghes.example.com/_services/token", gitHubAudience), jwt.MapClaims{
+				"repository_owner": "3lvia",
+				"repository":       "3lvia/core-demo-api",
+			}),
+			expectedError: "trusted issuer ghes: failed to validate claims: repository owner 3lvia is not valid",
+		},
+		{
+			name:     "github actions with wrong audience",
+			provider: IdentityProviderGitHubActions,
+			claims: withClaims(registeredClaims(gitHubIssuer, "https://github.com/other"), jwt.MapClaims{
+				"repository_owner": "3lvia",
+				"repository":       "3lvia/core-demo-api",
+			}),
+			expectedError: "trusted issuer github: failed to validate claims: invalid audience",
+		},
+		{
+			name:          "github actions with gitlab token",
+			provider:      IdentityProviderGitHubActions,
+			claims:        registeredClaims(gitLabIssuer, gitLabAudience),
+			expectedError: "issuer https://gitlab.com is not trusted",
+		},
+		{
+			name:     "gitlab ci",
+			provider: IdentityProviderGitLabCI,
+			claims: withClaims(registeredClaims(gitLabIssuer, gitLabAudience), jwt.MapClaims{
+				"sub":               "project_path:elvia/core/demo-api:ref_type:branch:ref:main",
+				"namespace_path":    "elvia/core",
+				"project_path":      "elvia/core/demo-api",
+				"ref":               "main",
+				"ref_type":          "branch",
+				"ci_config_ref_uri": "gitlab.com/elvia/core/demo-api//.gitlab-ci.yml@refs/heads/main",
+				"environment":       "prod",
+			}),
+			expectedIdentity: &CallerIdentity{
+				Provider:       IdentityProviderGitLabCI,
+				TrustedIssuer:  "gitlab",
+				Subject:        "project_path:elvia/core/demo-api:ref_type:branch:ref:main",
+				Owner:          "elvia/core",
+				Repository:     "elvia/core/demo-api",
+				JobWorkflowRef: "gitlab.com/elvia/core/demo-api//.gitlab-ci.yml@refs/heads/main",
+				Ref:            "refs/heads/main",
+				Environment:    "prod",
+			},
+		},
+		{
+			name:     "gitlab ci with other namespace",
+			provider: IdentityProviderGitLabCI,
+			claims: withClaims(registeredClaims(gitLabIssuer, gitLabAudience), jwt.MapClaims{
+				"namespace_path": "elvia-other",
+				"project_path":   "elvia-other/demo-api",
+			}),
+			expectedError: "trusted issuer gitlab: failed to validate claims: namespace elvia-other is not valid",
+		},
+		{
+			name:     "azure devops",
+			provider: IdentityProviderAzureDevOps,
+			claims: withClaims(registeredClaims(azureDevOpsIssuer, azureAudience), jwt.MapClaims{
+				"sub": "sc://elvia/core/deployvia",
+			}),
+			expectedIdentity: &CallerIdentity{
+				Provider:      IdentityProviderAzureDevOps,
+				TrustedIssuer: "azure-devops",
+				Subject:       "sc://elvia/core/deployvia",
+				Owner:         "elvia",
+				Repository:    "elvia/core",
+			},
+		},
+		{
+			name:     "azure devops with invalid subject",
+			provider: IdentityProviderAzureDevOps,
+			claims: withClaims(registeredClaims(azureDevOpsIssuer, azureAudience), jwt.MapClaims{
+				"sub": "elvia/core",
+			}),
+			expectedError: "trusted issuer azure-devops: failed to validate claims: subject elvia/core is not a service connection",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := getIdentityProvider(tt.provider).Authenticate(
+				context.Background(),
+				signToken(t, privateKey, tt.claims),
+			)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.expectedError) {
+					t.Errorf("Authenticate() error = '%v', expected '%s'", err, tt.expectedError)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate() error = '%v'", err)
+			}
+
+			if identity.ExpiresAt.IsZero() {
+				t.Errorf("Authenticate() returned no expiration time")
+			}
+
+			identity.ExpiresAt = time.Time{}
+
+			if *identity != *tt.expectedIdentity {
+				t.Errorf("Authenticate() = %+v, expected %+v", identity, tt.expectedIdentity)
+			}
+		})
+	}
+}
+
+func TestIdentityProviderWrongKey(t *testing.T) {
+	_, k := setupJWKSServer(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	identityProvider := NewGitHubActionsProvider([]TrustedIssuer{
+		{
+			Name:          "github",
+			Issuer:        "https://token.actions.githubusercontent.com",
+			Audiences:     []string{"https://github.com/3lvia"},
+			AllowedOwners: []string{"3lvia"},
+			Keyfunc:       k,
+		},
+	})
+
+	token := signToken(t, otherKey, withClaims(
+		registeredClaims("https://token.actions.githubusercontent.com", "https://github.com/3lvia"),
+		jwt.MapClaims{
+			"repository_owner": "3lvia",
+			"repository":       "3lvia/core-demo-api",
+		},
+	))
+
+	_, err = identityProvider.Authenticate(context.Background(), token)
+
+	expectedError := "trusted issuer github: failed to verify token"
+	if err == nil || !strings.HasPrefix(err.Error(), expectedError) {
+		t.Errorf("Authenticate() error = '%v', expected '%s'", err, expectedError)
+	}
+}
@@ -0,0 +1,217 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Policy maps the claims of a caller's token to the systems, applications and environments it may query.
+// A request is allowed if at least one rule matches both the caller and the requested deployment.
+type Policy struct {
+	Rules []PolicyRule `json:"rules"`
+
+	// The patterns containing '*', compiled once when the policy is parsed.
+	patterns map[string]*regexp.Regexp
+}
+
+type PolicyRule struct {
+	Name  string      `json:"name"`
+	Match PolicyMatch `json:"match"`
+	Allow PolicyAllow `json:"allow"`
+}
+
+// PolicyMatch lists patterns for the caller identity, where '*' matches any sequence of characters.
+// Empty lists match any value; all non-empty lists must match.
+// Repositories are named differently by each provider, e.g. 'owner/repo' on GitHub and 'group/project' on GitLab,
+// so rules matching repositories must also list the providers they are issued by.
+type PolicyMatch struct {
+	Providers       []string `json:"providers,omitempty"`
+	Repositories    []string `json:"repositories,omitempty"`
+	JobWorkflowRefs []string `json:"job_workflow_refs,omitempty"`
+	Refs            []string `json:"refs,omitempty"`
+	Environments    []string `json:"environments,omitempty"`
+	ServiceAccounts []string `json:"service_accounts,omitempty"`
+}
+
+const (
+	PolicyActionRefresh  = "refresh"
+	PolicyActionSync     = "sync"
+	PolicyActionRollback = "rollback"
+	PolicyActionLogs     = "logs"
+)
+
+// PolicyAllow lists patterns for the deployment fields, where '*' matches any sequence of characters.
+// Empty lists match nothing.
+type PolicyAllow struct {
+	Systems      []string `json:"systems"`
+	Applications []string `json:"applications"`
+	Environments []string `json:"environments"`
+	// Actions that modify the application, i.e. 'refresh', 'sync' and 'rollback', or read container logs, i.e. 'logs'. Must be granted explicitly.
+	Actions []string `json:"actions,omitempty"`
+}
+
+type PolicyDeniedError struct {
+	Reason string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return fmt.Sprintf("access denied: %s", e.Reason)
+}
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	policy := Policy{patterns: make(map[string]*regexp.Regexp)}
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("policy rule %d is missing a name", i)
+		}
+
+		if len(rule.Match.Repositories) > 0 && len(rule.Match.Providers) == 0 {
+			return nil, fmt.Errorf("policy rule %s matches repositories, but not the providers that issue them", rule.Name)
+		}
+
+		patterns := [][]string{
+			rule.Match.Providers,
+			rule.Match.Repositories,
+			rule.Match.JobWorkflowRefs,
+			rule.Match.Refs,
+			rule.Match.Environments,
+			rule.Match.ServiceAccounts,
+			rule.Allow.Systems,
+			rule.Allow.Applications,
+			rule.Allow.Environments,
+			rule.Allow.Actions,
+		}
+		for _, pattern := range slices.Concat(patterns...) {
+			if pattern == "" {
+				return nil, fmt.Errorf("policy rule %s contains an empty pattern", rule.Name)
+			}
+
+			if strings.Contains(pattern, "*") {
+				policy.patterns[pattern] = compilePattern(pattern)
+			}
+		}
+	}
+
+	return &policy, nil
+}
+
+// Authorize checks that the caller may access the deployment.
+// A nil policy allows everything except actions, which keeps the behaviour from before policies were introduced.
+func (p *Policy) Authorize(identity *CallerIdentity, deployment *Deployment) error {
+	if p == nil {
+		if actions := deployment.Actions(); len(actions) > 0 {
+			return &PolicyDeniedError{
+				Reason: fmt.Sprintf("actions %s must be allowed by a policy", strings.Join(actions, ", ")),
+			}
+		}
+
+		return nil
+	}
+
+	if identity == nil {
+		return &PolicyDeniedError{Reason: "caller has no identity"}
+	}
+
+	var matchedRules []string
+	for _, rule := range p.Rules {
+		if !p.matches(rule.Match, identity) {
+			continue
+		}
+
+		if p.allows(rule.Allow, deployment) {
+			return nil
+		}
+
+		matchedRules = append(matchedRules, rule.Name)
+	}
+
+	if len(matchedRules) == 0 {
+		return &PolicyDeniedError{
+			Reason: fmt.Sprintf(
+				"no policy rule matches %s (provider=%s, job_workflow_ref=%s, ref=%s, environment=%s)",
+				identity.Name(),
+				identity.Provider,
+				identity.JobWorkflowRef,
+				identity.Ref,
+				identity.Environment,
+			),
+		}
+	}
+
+	var actions string
+	if len(deployment.Actions()) > 0 {
+		actions = fmt.Sprintf(" with actions %s", strings.Join(deployment.Actions(), ", "))
+	}
+
+	return &PolicyDeniedError{
+		Reason: fmt.Sprintf(
+			"%s is not allowed to access application %s in system %s and environment %s%s (matched rules: %s)",
+			identity.Name(),
+			deployment.ApplicationName,
+			deployment.System,
+			deployment.Environment,
+			actions,
+			strings.Join(matchedRules, ", "),
+		),
+	}
+}
+
+func (p *Policy) matches(m PolicyMatch, identity *CallerIdentity) bool {
+	return p.matchesAny(m.Providers, identity.Provider, true) &&
+		p.matchesAny(m.Repositories, identity.Repository, true) &&
+		p.matchesAny(m.JobWorkflowRefs, identity.JobWorkflowRef, true) &&
+		p.matchesAny(m.Refs, identity.Ref, true) &&
+		p.matchesAny(m.Environments, identity.Environment, true) &&
+		p.matchesAny(m.ServiceAccounts, identity.ServiceAccount, true)
+}
+
+func (p *Policy) allows(a PolicyAllow, deployment *Deployment) bool {
+	for _, action := range deployment.Actions() {
+		if !p.matchesAny(a.Actions, action, false) {
+			return false
+		}
+	}
+
+	return p.matchesAny(a.Systems, deployment.System, false) &&
+		p.matchesAny(a.Applications, deployment.ApplicationName, false) &&
+		p.matchesAny(a.Environments, deployment.Environment, false)
+}
+
+func (p *Policy) matchesAny(patterns []string, value string, emptyMatchesAll bool) bool {
+	if len(patterns) == 0 {
+		return emptyMatchesAll
+	}
+
+	for _, pattern := range patterns {
+		if p.matchPattern(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) matchPattern(pattern string, value string) bool {
+	if !strings.Contains(pattern, "*") {
+		return pattern == value
+	}
+
+	return p.patterns[pattern].MatchString(value)
+}
+
+func compilePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
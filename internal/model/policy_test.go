@@ -0,0 +1,300 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+const testPolicy = `
+rules:
+  - name: core
+    match:
+      providers: ["github-actions"]
+      repositories: ["3lvia/core-*"]
+      refs: ["refs/heads/trunk"]
+    allow:
+      systems: ["core"]
+      applications: ["*"]
+      environments: ["dev", "test", "prod"]
+  - name: core-feature-branches
+    match:
+      providers: ["github-actions"]
+      repositories: ["3lvia/core-*"]
+    allow:
+      systems: ["core"]
+      applications: ["*"]
+      environments: ["dev"]
+  - name: shared-workflow
+    match:
+      job_workflow_refs: ["3lvia/core-github-actions-templates/.github/workflows/deploy.yml@*"]
+      environments: ["prod"]
+    allow:
+      systems: ["*"]
+      applications: ["*"]
+      environments: ["prod"]
+  - name: core-sync
+    match:
+      providers: ["github-actions"]
+      repositories: ["3lvia/core-*"]
+      refs: ["refs/heads/trunk"]
+    allow:
+      systems: ["core"]
+      applications: ["*"]
+      environments: ["dev"]
+      actions: ["refresh", "sync"]
+`
+
+func TestPolicyAuthorize(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = '%v'", err)
+	}
+
+	deployment := func(system string, environment string) *Deployment {
+		return &Deployment{
+			ApplicationName: "demo-api",
+			System:          system,
+			Environment:     environment,
+			ClusterType:     "aks",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		identity    *CallerIdentity
+		deployment  *Deployment
+		expectError bool
+	}{
+		{
+			name: "trunk can deploy to prod",
+			identity: &CallerIdentity{
+				Provider:       "github-actions",
+				Owner:          "3lvia",
+				Repository:     "3lvia/core-demo-api",
+				JobWorkflowRef: "3lvia/core-demo-api/.github/workflows/build-deploy.yml@refs/heads/trunk",
+				Ref:            "refs/heads/trunk",
+			},
+			deployment:  deployment("core", "prod"),
+			expectError: false,
+		},
+		{
+			name: "feature branch can deploy to dev",
+			identity: &CallerIdentity{
+				Provider:       "github-actions",
+				Owner:          "3lvia",
+				Repository:     "3lvia/core-demo-api",
+				JobWorkflowRef: "3lvia/core-demo-api/.github/workflows/build-deploy.yml@refs/heads/feature",
+				Ref:            "refs/heads/feature",
+			},
+			deployment:  deployment("core", "dev"),
+			expectError: false,
+		},
+		{
+			name: "feature branch can not deploy to prod",
+			identity: &CallerIdentity{
+				Provider:       "github-actions",
+				Owner:          "3lvia",
+				Repository:     "3lvia/core-demo-api",
+				JobWorkflowRef: "3lvia/core-demo-api/.github/workflows/build-deploy.yml@refs/heads/feature",
+				Ref:            "refs/heads/feature",
+			},
+			deployment:  deployment("core", "prod"),
+			expectError: true,
+		},
+		{
+			name: "other system is denied",
+			identity: &CallerIdentity{
+				Provider:   "github-actions",
+				Owner:      "3lvia",
+				Repository: "3lvia/core-demo-api",
+				Ref:        "refs/heads/trunk",
+			},
+			deployment:  deployment("kunde", "dev"),
+			expectError: true,
+		},
+		{
+			name: "unknown repository is denied",
+			identity: &CallerIdentity{
+				Provider:   "github-actions",
+				Owner:      "3lvia",
+				Repository: "3lvia/kunde-api",
+				Ref:        "refs/heads/trunk",
+			},
+			deployment:  deployment("kunde", "dev"),
+			expectError: true,
+		},
+		{
+			name: "project with the same path in another provider is denied",
+			identity: &CallerIdentity{
+				Provider:   "gitlab-ci",
+				Owner:      "3lvia",
+				Repository: "3lvia/core-demo-api",
+				Ref:        "refs/heads/trunk",
+			},
+			deployment:  deployment("core", "dev"),
+			expectError: true,
+		},
+		{
+			name: "shared workflow with prod environment",
+			identity: &CallerIdentity{
+				Provider:       "github-actions",
+				Owner:          "3lvia",
+				Repository:     "3lvia/kunde-api",
+				JobWorkflowRef: "3lvia/core-github-actions-templates/.github/workflows/deploy.yml@refs/heads/trunk",
+				Ref:            "refs/heads/trunk",
+				Environment:    "prod",
+			},
+			deployment:  deployment("kunde", "prod"),
+			expectError: false,
+		},
+		{
+			name: "shared workflow without environment",
+			identity: &CallerIdentity{
+				Provider:       "github-actions",
+				Owner:          "3lvia",
+				Repository:     "3lvia/kunde-api",
+				JobWorkflowRef: "3lvia/core-github-actions-templates/.github/workflows/deploy.yml@refs/heads/trunk",
+				Ref:            "refs/heads/trunk",
+			},
+			deployment:  deployment("kunde", "prod"),
+			expectError: true,
+		},
+		{
+			name: "trunk can trigger sync in dev",
+			identity: &CallerIdentity{
+				Provider:   "github-actions",
+				Owner:      "3lvia",
+				Repository: "3lvia/core-demo-api",
+				Ref:        "refs/heads/trunk",
+			},
+			deployment: func() *Deployment {
+				d := deployment("core", "dev")
+				d.TriggerSync = true
+				d.Refresh = true
+
+				return d
+			}(),
+			expectError: false,
+		},
+		{
+			name: "trunk can not trigger sync in prod",
+			identity: &CallerIdentity{
+				Provider:   "github-actions",
+				Owner:      "3lvia",
+				Repository: "3lvia/core-demo-api",
+				Ref:        "refs/heads/trunk",
+			},
+			deployment: func() *Deployment {
+				d := deployment("core", "prod")
+				d.TriggerSync = true
+
+				return d
+			}(),
+			expectError: true,
+		},
+		{
+			name: "trunk can not include logs without the logs action",
+			identity: &CallerIdentity{
+				Provider:   "github-actions",
+				Owner:      "3lvia",
+				Repository: "3lvia/core-demo-api",
+				Ref:        "refs/heads/trunk",
+			},
+			deployment: func() *Deployment {
+				d := deployment("core", "dev")
+				d.IncludeLogs = true
+
+				return d
+			}(),
+			expectError: true,
+		},
+		{
+			name: "feature branch can not refresh",
+			identity: &CallerIdentity{
+				Provider:   "github-actions",
+				Owner:      "3lvia",
+				Repository: "3lvia/core-demo-api",
+				Ref:        "refs/heads/feature",
+			},
+			deployment: func() *Deployment {
+				d := deployment("core", "dev")
+				d.Refresh = true
+
+				return d
+			}(),
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Authorize(tt.identity, tt.deployment)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Authorize() error = '%v', expectError %v", err, tt.expectError)
+			}
+
+			var policyDeniedError *PolicyDeniedError
+			if err != nil && !errors.As(err, &policyDeniedError) {
+				t.Errorf("Authorize() error = '%v', expected PolicyDeniedError", err)
+			}
+		})
+	}
+}
+
+func TestPolicyAuthorizeNilPolicy(t *testing.T) {
+	var policy *Policy
+
+	if err := policy.Authorize(&CallerIdentity{Repository: "3lvia/core-demo-api"}, &Deployment{System: "core"}); err != nil {
+		t.Errorf("Authorize() error = '%v', expected nil policy to allow everything", err)
+	}
+
+	if err := policy.Authorize(
+		&CallerIdentity{Repository: "3lvia/core-demo-api"},
+		&Deployment{System: "core", TriggerSync: true},
+	); err == nil {
+		t.Errorf("Authorize() error = nil, expected nil policy to deny actions")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		expectError bool
+	}{
+		{
+			name:        "valid policy",
+			policy:      testPolicy,
+			expectError: false,
+		},
+		{
+			name:        "unknown field",
+			policy:      "rules:\n  - name: core\n    match:\n      repository: [\"3lvia/core-*\"]\n",
+			expectError: true,
+		},
+		{
+			name:        "repositories without providers",
+			policy:      "rules:\n  - name: core\n    match:\n      repositories: [\"3lvia/core-*\"]\n",
+			expectError: true,
+		},
+		{
+			name:        "missing name",
+			policy:      "rules:\n  - allow:\n      systems: [\"core\"]\n",
+			expectError: true,
+		},
+		{
+			name:        "empty pattern",
+			policy:      "rules:\n  - name: core\n    allow:\n      systems: [\"\"]\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePolicy([]byte(tt.policy))
+			if (err != nil) != tt.expectError {
+				t.Errorf("ParsePolicy() error = '%v', expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
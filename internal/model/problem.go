@@ -0,0 +1,210 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// ProblemType identifies a class of errors with a stable URI, so that clients can act on errors without parsing messages.
+type ProblemType struct {
+	URI    string
+	Title  string
+	Status int
+}
+
+var (
+	ProblemValidationFailed = ProblemType{
+		URI:    "urn:deployvia:problem:validation-failed",
+		Title:  "Validation failed",
+		Status: 400,
+	}
+	ProblemTokenMissing = ProblemType{
+		URI:    "urn:deployvia:problem:token-missing",
+		Title:  "Token missing",
+		Status: 401,
+	}
+	ProblemTokenInvalid = ProblemType{
+		URI:    "urn:deployvia:problem:token-invalid",
+		Title:  "Token invalid",
+		Status: 401,
+	}
+	ProblemAccessDenied = ProblemType{
+		URI:    "urn:deployvia:problem:access-denied",
+		Title:  "Access denied",
+		Status: 403,
+	}
+	ProblemApplicationNotFound = ProblemType{
+		URI:    "urn:deployvia:problem:application-not-found",
+		Title:  "Application not found",
+		Status: 404,
+	}
+	ProblemApplicationNotGenerated = ProblemType{
+		URI:    "urn:deployvia:problem:application-not-generated",
+		Title:  "Application not generated",
+		Status: 404,
+	}
+	ProblemDeploymentJobNotFound = ProblemType{
+		URI:    "urn:deployvia:problem:deployment-job-not-found",
+		Title:  "Deployment job not found",
+		Status: 404,
+	}
+	ProblemAmbiguousApplication = ProblemType{
+		URI:    "urn:deployvia:problem:ambiguous-application",
+		Title:  "Ambiguous application",
+		Status: 409,
+	}
+	ProblemApplicationDegraded = ProblemType{
+		URI:    "urn:deployvia:problem:application-degraded",
+		Title:  "Application degraded",
+		Status: 422,
+	}
+	ProblemSyncFailed = ProblemType{
+		URI:    "urn:deployvia:problem:sync-failed",
+		Title:  "Sync failed",
+		Status: 422,
+	}
+	ProblemRolloutFailed = ProblemType{
+		URI:    "urn:deployvia:problem:rollout-failed",
+		Title:  "Rollout failed",
+		Status: 422,
+	}
+	ProblemApplicationSetFailed = ProblemType{
+		URI:    "urn:deployvia:problem:applicationset-failed",
+		Title:  "ApplicationSet failed",
+		Status: 422,
+	}
+	ProblemWorkloadNotFound = ProblemType{
+		URI:    "urn:deployvia:problem:workload-not-found",
+		Title:  "Workload not found",
+		Status: 422,
+	}
+	ProblemTooManyJobs = ProblemType{
+		URI:    "urn:deployvia:problem:too-many-jobs",
+		Title:  "Too many jobs",
+		Status: 429,
+	}
+	ProblemWatchFailed = ProblemType{
+		URI:    "urn:deployvia:problem:watch-failed",
+		Title:  "Watch failed",
+		Status: 502,
+	}
+	ProblemDeploymentTimeout = ProblemType{
+		URI:    "urn:deployvia:problem:deployment-timeout",
+		Title:  "Deployment timed out",
+		Status: 504,
+	}
+	// Used for errors that are not one of the types above.
+	ProblemInternal = ProblemType{
+		URI:    "about:blank",
+		Title:  "Internal Server Error",
+		Status: 500,
+	}
+)
+
+// DeploymentJobNotFoundError is returned when polling for a deployment job that does not exist or has expired.
+type DeploymentJobNotFoundError struct {
+	ID string
+}
+
+func (e *DeploymentJobNotFoundError) Error() string {
+	return fmt.Sprintf("deployment job %s not found", e.ID)
+}
+
+// TooManyJobsError is returned when starting an asynchronous deployment check while the maximum number of jobs are running.
+type TooManyJobsError struct {
+	MaxRunning int
+}
+
+func (e *TooManyJobsError) Error() string {
+	return fmt.Sprintf("%d deployment jobs are already running, retry once some of them have finished", e.MaxRunning)
+}
+
+// GetProblemType returns the problem type of the error.
+// Errors of several applications are combined so that only the last one is wrapped, which decides the type.
+func GetProblemType(err error) ProblemType {
+	var (
+		validationError          *ValidationError
+		tokenMissingError        *TokenMissingError
+		tokenInvalidError        *TokenInvalidError
+		policyDeniedError        *PolicyDeniedError
+		applicationNotFoundError *ApplicationNotFoundError
+		notGeneratedError        *ApplicationNotGeneratedError
+		jobNotFoundError         *DeploymentJobNotFoundError
+		tooManyJobsError         *TooManyJobsError
+		ambiguousError           *AmbiguousApplicationError
+		deploymentTimeoutError   *DeploymentTimeoutError
+		applicationFailedError   *ApplicationFailedError
+		applicationSetError      *ApplicationSetFailedError
+		workloadNotFoundError    *WorkloadNotFoundError
+		watchFailedError         *WatchFailedError
+	)
+
+	switch {
+	case errors.As(err, &validationError):
+		return ProblemValidationFailed
+	case errors.As(err, &tokenMissingError):
+		return ProblemTokenMissing
+	case errors.As(err, &tokenInvalidError):
+		return ProblemTokenInvalid
+	case errors.As(err, &policyDeniedError):
+		return ProblemAccessDenied
+	case errors.As(err, &applicationNotFoundError):
+		return ProblemApplicationNotFound
+	case errors.As(err, &notGeneratedError):
+		return ProblemApplicationNotGenerated
+	case errors.As(err, &jobNotFoundError):
+		return ProblemDeploymentJobNotFound
+	case errors.As(err, &ambiguousError):
+		return ProblemAmbiguousApplication
+	case errors.As(err, &deploymentTimeoutError):
+		return ProblemDeploymentTimeout
+	case errors.As(err, &applicationFailedError):
+		switch applicationFailedError.Reason {
+		case FailureReasonSyncFailed:
+			return ProblemSyncFailed
+		case FailureReasonRolloutAborted, FailureReasonAnalysisFailed:
+			return ProblemRolloutFailed
+		default:
+			return ProblemApplicationDegraded
+		}
+	case errors.As(err, &applicationSetError):
+		return ProblemApplicationSetFailed
+	case errors.As(err, &workloadNotFoundError):
+		return ProblemWorkloadNotFound
+	case errors.As(err, &tooManyJobsError):
+		return ProblemTooManyJobs
+	case errors.As(err, &watchFailedError):
+		return ProblemWatchFailed
+	default:
+		return ProblemInternal
+	}
+}
+
+// Problem is an RFC 7807 problem details document.
+// Failed deployments extend it with the fields of their 'DeploymentResult'.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// The request path the problem occurred at.
+	Instance string `json:"instance,omitempty"`
+
+	*DeploymentResult
+}
+
+func NewProblem(err error, instance string, result *DeploymentResult) *Problem {
+	problemType := GetProblemType(err)
+
+	return &Problem{
+		Type:             problemType.URI,
+		Title:            problemType.Title,
+		Status:           problemType.Status,
+		Detail:           err.Error(),
+		Instance:         instance,
+		DeploymentResult: result,
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetProblemType(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected ProblemType
+	}{
+		{
+			name:     "validation failed",
+			err:      &ValidationError{Err: fmt.Errorf("invalid deployment: image is required")},
+			expected: ProblemValidationFailed,
+		},
+		{
+			name:     "token missing",
+			err:      &TokenMissingError{TokenHeaders: []string{"X-GitHub-OIDC-Token"}},
+			expected: ProblemTokenMissing,
+		},
+		{
+			name:     "token invalid",
+			err:      &TokenInvalidError{Err: fmt.Errorf("token has already been used")},
+			expected: ProblemTokenInvalid,
+		},
+		{
+			name:     "access denied",
+			err:      &PolicyDeniedError{Reason: "caller has no identity"},
+			expected: ProblemAccessDenied,
+		},
+		{
+			name:     "application not found",
+			err:      &ApplicationNotFoundError{},
+			expected: ProblemApplicationNotFound,
+		},
+		{
+			name:     "application not generated",
+			err:      &ApplicationNotGeneratedError{ApplicationSet: "core-demo-api", ClusterType: "gke"},
+			expected: ProblemApplicationNotGenerated,
+		},
+		{
+			name: "applicationset failed after application errors",
+			err: fmt.Errorf(
+				"%w; %v",
+				&ApplicationFailedError{Reason: FailureReasonSyncFailed},
+				&ApplicationSetFailedError{ApplicationSet: "core-demo-api"},
+			),
+			expected: ProblemSyncFailed,
+		},
+		{
+			name:     "ambiguous application",
+			err:      &AmbiguousApplicationError{Applications: []string{"a", "b"}},
+			expected: ProblemAmbiguousApplication,
+		},
+		{
+			name:     "application degraded",
+			err:      fmt.Errorf("failed to watch a: %w", &ApplicationFailedError{Reason: FailureReasonDegraded}),
+			expected: ProblemApplicationDegraded,
+		},
+		{
+			name:     "sync failed",
+			err:      fmt.Errorf("failed to watch a: %w", &ApplicationFailedError{Reason: FailureReasonSyncFailed}),
+			expected: ProblemSyncFailed,
+		},
+		{
+			name:     "rollout aborted",
+			err:      fmt.Errorf("failed to watch a: %w", &ApplicationFailedError{Reason: FailureReasonRolloutAborted}),
+			expected: ProblemRolloutFailed,
+		},
+		{
+			name:     "rollout analysis failed",
+			err:      fmt.Errorf("failed to watch a: %w", &ApplicationFailedError{Reason: FailureReasonAnalysisFailed}),
+			expected: ProblemRolloutFailed,
+		},
+		{
+			name: "timeout is reported after other application errors",
+			err: fmt.Errorf(
+				"%v; %w",
+				&ApplicationFailedError{Reason: FailureReasonDegraded},
+				&DeploymentTimeoutError{Timeout: time.Minute, PendingApplications: []string{"b"}},
+			),
+			expected: ProblemDeploymentTimeout,
+		},
+		{
+			name:     "workload not found",
+			err:      fmt.Errorf("failed to watch a: %w", &WorkloadNotFoundError{Image: "ghcr.io/3lvia/core-demo-api:dev"}),
+			expected: ProblemWorkloadNotFound,
+		},
+		{
+			name:     "too many jobs",
+			err:      &TooManyJobsError{MaxRunning: 100},
+			expected: ProblemTooManyJobs,
+		},
+		{
+			name:     "watch failed",
+			err:      &WatchFailedError{Err: fmt.Errorf("connection refused")},
+			expected: ProblemWatchFailed,
+		},
+		{
+			name:     "unknown error",
+			err:      fmt.Errorf("something went wrong"),
+			expected: ProblemInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if problemType := GetProblemType(tt.err); problemType != tt.expected {
+				t.Errorf("GetProblemType() = %+v, expected %+v", problemType, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewProblem(t *testing.T) {
+	problem := NewProblem(&ApplicationNotFoundError{}, "/deployment", NewDeploymentResult(nil, &ApplicationNotFoundError{}))
+
+	data, err := json.Marshal(problem)
+	if err != nil {
+		t.Fatalf("Failed to marshal problem: %v", err)
+	}
+
+	// The deployment result is flattened into the problem as extension members.
+	expected := `{"type":"urn:deployvia:problem:application-not-found","title":"Application not found","status":404,` +
+		`"detail":"application(s) not found","instance":"/deployment","version":"v1","success":false,` +
+		`"error":"application(s) not found","error_type":"urn:deployvia:problem:application-not-found","applications":[]}`
+	if string(data) != expected {
+		t.Errorf("Problem JSON = %s, expected %s", data, expected)
+	}
+
+	data, err = json.Marshal(NewProblem(&TokenMissingError{TokenHeaders: []string{"A", "B"}}, "", nil))
+	if err != nil {
+		t.Fatalf("Failed to marshal problem: %v", err)
+	}
+
+	expected = `{"type":"urn:deployvia:problem:token-missing","title":"Token missing","status":401,` +
+		`"detail":"one of the A, B headers is required"}`
+	if string(data) != expected {
+		t.Errorf("Problem JSON = %s, expected %s", data, expected)
+	}
+}
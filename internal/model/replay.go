@@ -0,0 +1,157 @@
+package model
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ReplayPolicy string
+
+const (
+	ReplayPolicyOff    ReplayPolicy = "off"
+	ReplayPolicyWarn   ReplayPolicy = "warn"
+	ReplayPolicyReject ReplayPolicy = "reject"
+)
+
+func ParseReplayPolicy(policy string) (ReplayPolicy, error) {
+	switch ReplayPolicy(policy) {
+	case ReplayPolicyOff, ReplayPolicyWarn, ReplayPolicyReject:
+		return ReplayPolicy(policy), nil
+	case "":
+		return ReplayPolicyOff, nil
+	default:
+		return "", fmt.Errorf("invalid replay policy %s, must be one of off, warn or reject", policy)
+	}
+}
+
+// ReplayStore records token IDs until they expire.
+// Implementations must be safe for concurrent use; a shared backend is needed when running multiple replicas.
+type ReplayStore interface {
+	// Record stores the token ID, returning false if it was already recorded and has not expired.
+	Record(ctx context.Context, tokenID string, expiresAt time.Time) (bool, error)
+}
+
+// ReplayProtection rejects or warns about tokens whose 'jti' has been seen before.
+type ReplayProtection struct {
+	Policy ReplayPolicy
+	Store  ReplayStore
+	// Called for every replayed token, e.g. to count replay attempts.
+	OnReplay func(ctx context.Context, identity *CallerIdentity)
+}
+
+// Check records the token of the caller. ServiceAccount tokens are not checked, since pods reuse their projected token until the kubelet rotates it.
+// Tokens without a 'jti' claim can not be tracked, so they are rejected with the 'reject' policy, and only logged with 'warn'.
+func (r *ReplayProtection) Check(ctx context.Context, identity *CallerIdentity) error {
+	if r == nil || r.Policy == ReplayPolicyOff || identity == nil {
+		return nil
+	}
+
+	if identity.Provider == IdentityProviderKubernetes {
+		return nil
+	}
+
+	if identity.TokenID == "" {
+		if r.Policy == ReplayPolicyWarn {
+			log.Warnf("Token from %s has no jti claim, it can not be checked for replays", identity.Name())
+
+			return nil
+		}
+
+		return &TokenInvalidError{Err: fmt.Errorf("token has no jti claim, which is required to reject replayed tokens")}
+	}
+
+	// Token IDs are only unique per issuer.
+	key := fmt.Sprintf("%s/%s/%s", identity.Provider, identity.TrustedIssuer, identity.TokenID)
+
+	recorded, err := r.Store.Record(ctx, key, identity.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record token ID: %w", err)
+	}
+
+	if recorded {
+		return nil
+	}
+
+	if r.OnReplay != nil {
+		r.OnReplay(ctx, identity)
+	}
+
+	if r.Policy == ReplayPolicyWarn {
+		log.Warnf("Token %s from %s has already been used", identity.TokenID, identity.Name())
+
+		return nil
+	}
+
+	return &TokenInvalidError{Err: fmt.Errorf("token %s has already been used", identity.TokenID)}
+}
+
+type memoryReplayStore struct {
+	mu         sync.Mutex
+	expiresAt  map[string]time.Time
+	expiry     replayExpiryHeap
+	maxEntries int
+}
+
+// NewMemoryReplayStore creates an in-process store holding at most maxEntries token IDs.
+// When full, the token IDs closest to expiring are evicted first.
+func NewMemoryReplayStore(maxEntries int) ReplayStore {
+	return &memoryReplayStore{
+		expiresAt:  make(map[string]time.Time),
+		maxEntries: maxEntries,
+	}
+}
+
+func (s *memoryReplayStore) Record(_ context.Context, tokenID string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	for len(s.expiry) > 0 && !s.expiry[0].expiresAt.After(now) {
+		entry := heap.Pop(&s.expiry).(replayEntry)
+		delete(s.expiresAt, entry.tokenID)
+	}
+
+	if _, found := s.expiresAt[tokenID]; found {
+		return false, nil
+	}
+
+	for len(s.expiry) >= s.maxEntries && len(s.expiry) > 0 {
+		entry := heap.Pop(&s.expiry).(replayEntry)
+		delete(s.expiresAt, entry.tokenID)
+	}
+
+	s.expiresAt[tokenID] = expiresAt
+	heap.Push(&s.expiry, replayEntry{tokenID: tokenID, expiresAt: expiresAt})
+
+	return true, nil
+}
+
+type replayEntry struct {
+	tokenID   string
+	expiresAt time.Time
+}
+
+type replayExpiryHeap []replayEntry
+
+func (h replayExpiryHeap) Len() int           { return len(h) }
+func (h replayExpiryHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h replayExpiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *replayExpiryHeap) Push(x any) {
+	*h = append(*h, x.(replayEntry))
+}
+
+func (h *replayExpiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[:n-1]
+
+	return entry
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReplayProtection(t *testing.T) {
+	ctx := context.Background()
+
+	identity := func(provider string, tokenID string) *CallerIdentity {
+		return &CallerIdentity{
+			Provider:      provider,
+			TrustedIssuer: "github",
+			Repository:    "3lvia/core-demo-api",
+			TokenID:       tokenID,
+			ExpiresAt:     time.Now().Add(5 * time.Minute),
+		}
+	}
+
+	tests := []struct {
+		name            string
+		provider        string
+		policy          ReplayPolicy
+		tokenIDs        []string
+		expectError     bool
+		expectedReplays int
+	}{
+		{
+			name:            "reject replayed token",
+			policy:          ReplayPolicyReject,
+			tokenIDs:        []string{"a", "b", "a"},
+			expectError:     true,
+			expectedReplays: 1,
+		},
+		{
+			name:            "warn about replayed token",
+			policy:          ReplayPolicyWarn,
+			tokenIDs:        []string{"a", "a", "a"},
+			expectError:     false,
+			expectedReplays: 2,
+		},
+		{
+			name:            "off",
+			policy:          ReplayPolicyOff,
+			tokenIDs:        []string{"a", "a"},
+			expectError:     false,
+			expectedReplays: 0,
+		},
+		{
+			name:            "reject token without ID",
+			policy:          ReplayPolicyReject,
+			tokenIDs:        []string{""},
+			expectError:     true,
+			expectedReplays: 0,
+		},
+		{
+			name:            "warn about tokens without ID",
+			policy:          ReplayPolicyWarn,
+			tokenIDs:        []string{"", ""},
+			expectError:     false,
+			expectedReplays: 0,
+		},
+		{
+			name:            "serviceaccount token without ID",
+			provider:        IdentityProviderKubernetes,
+			policy:          ReplayPolicyReject,
+			tokenIDs:        []string{""},
+			expectError:     false,
+			expectedReplays: 0,
+		},
+		{
+			name:            "serviceaccount token reused by the same pod",
+			provider:        IdentityProviderKubernetes,
+			policy:          ReplayPolicyReject,
+			tokenIDs:        []string{"a", "a"},
+			expectError:     false,
+			expectedReplays: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replays := 0
+			replayProtection := &ReplayProtection{
+				Policy: tt.policy,
+				Store:  NewMemoryReplayStore(100),
+				OnReplay: func(_ context.Context, _ *CallerIdentity) {
+					replays++
+				},
+			}
+
+			var err error
+			for _, tokenID := range tt.tokenIDs {
+				if err = replayProtection.Check(ctx, identity(cmp.Or(tt.provider, IdentityProviderGitHubActions), tokenID)); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != tt.expectError {
+				t.Errorf("Check() error = '%v', expectError %v", err, tt.expectError)
+			}
+
+			var tokenInvalidError *TokenInvalidError
+			if err != nil && !errors.As(err, &tokenInvalidError) {
+				t.Errorf("Check() error = '%v', expected TokenInvalidError", err)
+			}
+
+			if replays != tt.expectedReplays {
+				t.Errorf("Check() counted %d replays, expected %d", replays, tt.expectedReplays)
+			}
+		})
+	}
+}
+
+func TestMemoryReplayStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryReplayStore(2)
+
+	record := func(tokenID string, expiresAt time.Time) bool {
+		recorded, err := store.Record(ctx, tokenID, expiresAt)
+		if err != nil {
+			t.Fatalf("Record() error = '%v'", err)
+		}
+
+		return recorded
+	}
+
+	if !record("expired", time.Now().Add(-1*time.Second)) {
+		t.Errorf("Record() did not record new token ID")
+	}
+
+	if !record("expired", time.Now().Add(5*time.Minute)) {
+		t.Errorf("Record() did not record token ID after the previous one expired")
+	}
+
+	if record("expired", time.Now().Add(5*time.Minute)) {
+		t.Errorf("Record() recorded the same token ID twice")
+	}
+
+	record("b", time.Now().Add(10*time.Minute))
+	record("c", time.Now().Add(15*time.Minute))
+
+	// The store is bounded, so the token ID closest to expiring has been evicted.
+	if !record("expired", time.Now().Add(5*time.Minute)) {
+		t.Errorf("Record() did not evict the token ID closest to expiring")
+	}
+
+	if record("c", time.Now().Add(15*time.Minute)) {
+		t.Errorf("Record() evicted the wrong token ID")
+	}
+}
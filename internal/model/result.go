@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// DeploymentResultVersion is bumped when fields of 'DeploymentResult' are changed or removed, but not when they are added.
+const DeploymentResultVersion = "v1"
+
+const (
+	ApplicationOutcomeDeployed  = "deployed"
+	ApplicationOutcomeFailed    = "failed"
+	ApplicationOutcomeTimedOut  = "timed_out"
+	ApplicationOutcomeCancelled = "cancelled"
+)
+
+// DeploymentResult is the outcome of watching a deployment, returned both on success and on failure.
+type DeploymentResult struct {
+	Version string `json:"version"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// The problem type URI of the error, see 'GetProblemType'.
+	ErrorType string `json:"error_type,omitempty"`
+	// Every matched application, sorted by name. Empty if the deployment failed before any were watched.
+	Applications []ApplicationResult `json:"applications"`
+	// Applications that were not deployed when the deadline passed.
+	PendingApplications []string `json:"pending_applications,omitempty"`
+}
+
+// ApplicationResult is the final status of a single application.
+type ApplicationResult struct {
+	ApplicationStatus
+	// One of 'deployed', 'failed', 'timed_out' or 'cancelled'.
+	Outcome        string  `json:"outcome"`
+	Error          string  `json:"error,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// Collected if the application failed or timed out.
+	Diagnostics *Diagnostics `json:"diagnostics,omitempty"`
+}
+
+func NewApplicationResult(status ApplicationStatus, outcome string, err error, elapsed time.Duration) ApplicationResult {
+	result := ApplicationResult{
+		ApplicationStatus: status,
+		Outcome:           outcome,
+		ElapsedSeconds:    elapsed.Seconds(),
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func NewDeploymentResult(applications []ApplicationResult, err error) *DeploymentResult {
+	result := &DeploymentResult{
+		Version:      DeploymentResultVersion,
+		Success:      err == nil,
+		Applications: applications,
+	}
+
+	if result.Applications == nil {
+		result.Applications = []ApplicationResult{}
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorType = GetProblemType(err).URI
+
+		var deploymentTimeoutError *DeploymentTimeoutError
+		if errors.As(err, &deploymentTimeoutError) {
+			result.PendingApplications = deploymentTimeoutError.PendingApplications
+		}
+	} else {
+		result.Message = "Application successfully deployed!"
+	}
+
+	return result
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewDeploymentResult(t *testing.T) {
+	applications := []ApplicationResult{
+		NewApplicationResult(
+			ApplicationStatus{Name: "core-demo-api-dev-aks", ClusterType: "aks", Deployed: true},
+			ApplicationOutcomeDeployed,
+			nil,
+			2*time.Second,
+		),
+		NewApplicationResult(
+			ApplicationStatus{Name: "core-demo-api-dev-gke", ClusterType: "gke"},
+			ApplicationOutcomeTimedOut,
+			fmt.Errorf("timed out"),
+			3*time.Second,
+		),
+	}
+
+	result := NewDeploymentResult(applications, fmt.Errorf(
+		"failed to trigger: %w",
+		&DeploymentTimeoutError{Timeout: time.Minute, PendingApplications: []string{"core-demo-api-dev-gke"}},
+	))
+
+	if result.Version != DeploymentResultVersion || result.Success {
+		t.Errorf("NewDeploymentResult() = %+v, expected failed %s result", result, DeploymentResultVersion)
+	}
+
+	if !slices.Equal(result.PendingApplications, []string{"core-demo-api-dev-gke"}) {
+		t.Errorf("NewDeploymentResult() pending applications = %v, expected [core-demo-api-dev-gke]", result.PendingApplications)
+	}
+
+	data, err := json.Marshal(result.Applications[1])
+	if err != nil {
+		t.Fatalf("Failed to marshal application result: %v", err)
+	}
+
+	// The application status is flattened into the result, so that clients can render it as a table row.
+	expected := `{"name":"core-demo-api-dev-gke","cluster_type":"gke","sync_status":"","health_status":"","images":null,` +
+		`"deployed":false,"outcome":"timed_out","error":"timed out","elapsed_seconds":3}`
+	if string(data) != expected {
+		t.Errorf("Application result JSON = %s, expected %s", data, expected)
+	}
+
+	if result := NewDeploymentResult(nil, nil); !result.Success || result.Applications == nil {
+		t.Errorf("NewDeploymentResult() = %+v, expected successful result with empty applications", result)
+	}
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ApplicationStatus is a snapshot of an Argo CD Application as observed while watching a deployment.
+type ApplicationStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// The management cluster running the Argo CD instance, if several are configured.
+	Cluster      string   `json:"cluster,omitempty"`
+	ClusterType  string   `json:"cluster_type"`
+	SyncStatus   string   `json:"sync_status"`
+	HealthStatus string   `json:"health_status"`
+	Images       []string `json:"images"`
+	Revision     string   `json:"revision,omitempty"`
+	Deployed     bool     `json:"deployed"`
+	// The rollout of the workloads running the image, if 'verify_workloads' is set and Argo CD reports the image as deployed.
+	Workloads []WorkloadStatus `json:"workloads,omitempty"`
+	// The progress of the Argo Rollouts of the application.
+	Rollouts []RolloutStatus `json:"rollouts,omitempty"`
+	// Set once the application is being rolled back after a failed deployment.
+	Rollback *RollbackStatus `json:"rollback,omitempty"`
+}
+
+// Key identifies the application among those of a deployment, which may have the same name in different namespaces or clusters.
+func (s ApplicationStatus) Key() string {
+	key := s.Name
+	if s.Namespace != "" {
+		key = s.Namespace + "/" + key
+	}
+
+	if s.Cluster != "" {
+		key = s.Cluster + "/" + key
+	}
+
+	return key
+}
+
+// WorkloadStatus is the rollout of a Deployment, StatefulSet or Rollout running the image of a deployment,
+// as observed in the cluster the application is deployed to.
+type WorkloadStatus struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Whether the controller has observed the latest generation of the workload.
+	GenerationObserved bool  `json:"generation_observed"`
+	Replicas           int64 `json:"replicas"`
+	UpdatedReplicas    int64 `json:"updated_replicas"`
+	AvailableReplicas  int64 `json:"available_replicas"`
+	// Pods of the workload that are not terminating, and those of them running the requested image digest.
+	Pods          int  `json:"pods"`
+	PodsWithImage int  `json:"pods_with_image"`
+	Verified      bool `json:"verified"`
+	// Why the workload is not verified yet.
+	Message string `json:"message,omitempty"`
+}
+
+// RolloutStatus is the progress of an Argo Rollout of the application.
+// Only the health reported by Argo CD is known if deployvia has no access to the cluster the application is deployed to.
+type RolloutStatus struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Either 'canary' or 'blueGreen'.
+	Strategy string `json:"strategy,omitempty"`
+	Phase    string `json:"phase"`
+	Message  string `json:"message,omitempty"`
+	// The index of the current canary step, out of 'steps', and the weight of the canary in percent.
+	CurrentStep *int64 `json:"current_step,omitempty"`
+	Steps       int64  `json:"steps,omitempty"`
+	Weight      *int64 `json:"weight,omitempty"`
+	// Whether the rollout is paused at a canary step, or before promoting a blue-green preview.
+	Paused  bool `json:"paused"`
+	Aborted bool `json:"aborted"`
+	// The pod template hash of the current revision, 'status.currentPodHash'.
+	PodHash      string              `json:"pod_hash,omitempty"`
+	AnalysisRuns []AnalysisRunStatus `json:"analysis_runs,omitempty"`
+}
+
+func (s RolloutStatus) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Rollout/%s/%s (%s)", s.Namespace, s.Name, s.Phase)
+
+	if s.CurrentStep != nil {
+		fmt.Fprintf(&b, " at step %d/%d", *s.CurrentStep, s.Steps)
+	}
+
+	if s.Weight != nil {
+		fmt.Fprintf(&b, " with weight %d%%", *s.Weight)
+	}
+
+	if s.Message != "" {
+		fmt.Fprintf(&b, ": %s", s.Message)
+	}
+
+	for _, analysisRun := range s.AnalysisRuns {
+		fmt.Fprintf(&b, "; %s", analysisRun)
+	}
+
+	return b.String()
+}
+
+// AnalysisRunStatus is the result of an AnalysisRun of the current revision of a Rollout.
+type AnalysisRunStatus struct {
+	Name    string `json:"name"`
+	Phase   string `json:"phase"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s AnalysisRunStatus) String() string {
+	if s.Message != "" {
+		return fmt.Sprintf("AnalysisRun/%s (%s): %s", s.Name, s.Phase, s.Message)
+	}
+
+	return fmt.Sprintf("AnalysisRun/%s (%s)", s.Name, s.Phase)
+}
+
+// RollbackStatus is the outcome of rolling an application back to a previous revision from its history.
+type RollbackStatus struct {
+	HistoryID int64  `json:"history_id"`
+	Revision  string `json:"revision"`
+	Finished  bool   `json:"finished"`
+	Succeeded bool   `json:"succeeded"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ApplicationSummary is the current state of an Argo CD Application, returned without waiting for a deployment.
+type ApplicationSummary struct {
+	Name         string   `json:"name"`
+	Namespace    string   `json:"namespace,omitempty"`
+	Cluster      string   `json:"cluster,omitempty"`
+	ClusterType  string   `json:"cluster_type"`
+	SyncStatus   string   `json:"sync_status"`
+	HealthStatus string   `json:"health_status"`
+	Images       []string `json:"images"`
+	// The revision the application is synced to, and the revision it tracks, e.g. a branch.
+	Revision       string `json:"revision,omitempty"`
+	TargetRevision string `json:"target_revision,omitempty"`
+	// When the last sync operation finished, if Argo CD has recorded one.
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+}
@@ -2,6 +2,7 @@ package route
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/3lvia/deployvia/internal/config"
 	"github.com/3lvia/deployvia/internal/handler"
@@ -24,9 +25,40 @@ func RegisterRoutes(ctx context.Context, router *gin.Engine, conf *config.Config
 		})
 	})
 
+	router.GET("/ready", func(c *gin.Context) {
+		for _, cluster := range conf.Clusters {
+			for namespace, applicationInformer := range cluster.ApplicationInformers {
+				if !applicationInformer.HasSynced() {
+					message := fmt.Sprintf("Application cache for namespace %s has not synced", namespace)
+					if cluster.Name != "" {
+						message = fmt.Sprintf("%s in cluster %s", message, cluster.Name)
+					}
+
+					c.JSON(503, gin.H{
+						"message": message,
+					})
+
+					return
+				}
+			}
+		}
+
+		c.JSON(200, gin.H{
+			"message": "OK",
+		})
+	})
+
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	router.POST("/deployment", func(c *gin.Context) {
 		handler.PostDeployment(ctx, c, conf)
 	})
+
+	router.GET("/deployment/:id", func(c *gin.Context) {
+		handler.GetDeployment(ctx, c, conf)
+	})
+
+	router.GET("/applications/:system/:application", func(c *gin.Context) {
+		handler.GetApplications(ctx, c, conf)
+	})
 }